@@ -0,0 +1,78 @@
+package n3x
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// accessConfig gathers the settings that together decide how the runners
+// are reached, so contradictory combinations can be caught in one place.
+type accessConfig struct {
+	sshAccess               string // "ssh" or "ssm"
+	createKeyPair           bool
+	createInstanceProfile   bool
+	associatePublicIp       bool
+	sshCidrBlocks           string
+	sshPort                 int
+	sshPortSet              bool // n3x:sshPort given explicitly
+	instanceConnectEndpoint bool
+	extraIngress            []sgRule // n3x:extraIngressRules
+}
+
+// validateAccessConfig rejects access settings that contradict each other:
+// SSH paths without a key to log in with, SSM access without the instance
+// profile Session Manager needs, SSH open to the world on runners that have
+// no public IP and no endpoint to reach them through, an SSM-only fleet that
+// still opens SSH to the world through extraIngressRules, and an sshPort
+// nothing uses.
+func validateAccessConfig(a accessConfig) error {
+	if !a.createKeyPair && a.sshAccess != "ssm" {
+		return configErrorf("createKeyPair", "set n3x:sshAccess ssm", "false requires SSM access (without a key pair there is no SSH login)")
+	}
+	if !a.createKeyPair && !a.createInstanceProfile {
+		// Session Manager is the only way in, and it needs the SSM policy
+		return configErrorf("createKeyPair", "set n3x:createInstanceProfile", "false requires the stack's instance profile for Session Manager")
+	}
+	if a.sshAccess == "ssm" && !a.createInstanceProfile {
+		return configErrorf("sshAccess", "set n3x:createInstanceProfile", "ssm requires the stack's instance profile (AmazonSSMManagedInstanceCore)")
+	}
+	if a.sshAccess == "ssh" && !a.associatePublicIp && a.sshCidrBlocks == "0.0.0.0/0" && !a.instanceConnectEndpoint {
+		return configErrorf("associatePublicIp", "enable n3x:instanceConnectEndpoint, or restrict n3x:sshCidrBlocks to the network you connect from",
+			"false leaves SSH open to 0.0.0.0/0 with no public IP and no endpoint to reach it through")
+	}
+	if !a.createKeyPair && a.instanceConnectEndpoint {
+		return configErrorf("instanceConnectEndpoint", "set n3x:createKeyPair true or unset n3x:instanceConnectEndpoint",
+			"the endpoint tunnels SSH, but n3x:createKeyPair is false (no key to log in with)")
+	}
+	if a.sshAccess == "ssm" {
+		for _, r := range a.extraIngress {
+			if !r.covers("tcp", a.sshPort) || !slices.Contains(r.cidrBlocks, "0.0.0.0/0") {
+				continue
+			}
+			return configErrorf("extraIngressRules", "narrow the rule's CIDR blocks or set n3x:sshAccess ssh",
+				"rule %q opens SSH (port %d) to 0.0.0.0/0 on an SSM-only fleet (sshAccess ssm)", r.description, a.sshPort)
+		}
+		if a.sshPortSet && !a.instanceConnectEndpoint {
+			return configErrorf("sshPort", "unset it, or enable n3x:instanceConnectEndpoint", "unused with sshAccess ssm (no SSH path)")
+		}
+	}
+	return nil
+}
+
+// sshKeyFingerprint returns the SHA256 fingerprint of an authorized_keys
+// line ("ssh-ed25519 AAAA... comment") in the form ssh-keygen -l prints.
+func sshKeyFingerprint(publicKey string) (string, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return "", fmt.Errorf(`expected "<type> <base64 key> [comment]"`)
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("key data: %w", err)
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
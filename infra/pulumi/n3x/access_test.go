@@ -0,0 +1,72 @@
+package n3x
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateAccessConfig(t *testing.T) {
+	// valid returns a working SSH setup that each case breaks in one way.
+	valid := func() accessConfig {
+		return accessConfig{
+			sshAccess:             "ssh",
+			createKeyPair:         true,
+			createInstanceProfile: true,
+			associatePublicIp:     true,
+			sshCidrBlocks:         "0.0.0.0/0",
+			sshPort:               22,
+		}
+	}
+	openSsh := sgRule{"tcp", 22, 22, []string{"0.0.0.0/0"}, "debug ssh"}
+
+	tests := []struct {
+		name   string
+		modify func(a *accessConfig)
+		key    string // ConfigError key, or "" for no error
+	}{
+		{"valid", func(a *accessConfig) {}, ""},
+		{"no key pair with ssh", func(a *accessConfig) { a.createKeyPair = false }, "createKeyPair"},
+		{"no key pair without instance profile", func(a *accessConfig) {
+			a.sshAccess, a.createKeyPair, a.createInstanceProfile = "ssm", false, false
+		}, "createKeyPair"},
+		{"ssm without instance profile", func(a *accessConfig) {
+			a.sshAccess, a.createInstanceProfile = "ssm", false
+		}, "sshAccess"},
+		{"no public ip, open ssh, no endpoint", func(a *accessConfig) { a.associatePublicIp = false }, "associatePublicIp"},
+		{"no public ip, open ssh, endpoint", func(a *accessConfig) {
+			a.associatePublicIp, a.instanceConnectEndpoint = false, true
+		}, ""},
+		{"no public ip, restricted ssh", func(a *accessConfig) {
+			a.associatePublicIp, a.sshCidrBlocks = false, "10.0.0.0/8"
+		}, ""},
+		{"endpoint without key pair", func(a *accessConfig) {
+			a.sshAccess, a.createKeyPair, a.instanceConnectEndpoint = "ssm", false, true
+		}, "instanceConnectEndpoint"},
+		{"ssm with open ssh rule", func(a *accessConfig) {
+			a.sshAccess, a.extraIngress = "ssm", []sgRule{openSsh}
+		}, "extraIngressRules"},
+		{"ssm with unused ssh port", func(a *accessConfig) {
+			a.sshAccess, a.sshPortSet = "ssm", true
+		}, "sshPort"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := valid()
+			tt.modify(&a)
+			err := validateAccessConfig(a)
+			if tt.key == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var ce *ConfigError
+			if !errors.As(err, &ce) {
+				t.Fatalf("got %v, want a ConfigError for %s", err, tt.key)
+			}
+			if ce.Key != tt.key {
+				t.Errorf("key = %q, want %q (%v)", ce.Key, tt.key, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package n3x
+
+import (
+	"fmt"
+	"strings"
+)
+
+// compositeAlarmRule returns a CloudWatch composite alarm rule that is in
+// ALARM when any of the named alarms is.
+func compositeAlarmRule(alarmNames []string) string {
+	terms := make([]string, len(alarmNames))
+	for i, name := range alarmNames {
+		terms[i] = fmt.Sprintf("ALARM(%q)", name)
+	}
+	return strings.Join(terms, " OR ")
+}
@@ -0,0 +1,62 @@
+package n3x
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ebs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// existingCacheAz returns the AZ of this stack's volume with the given Name
+// tag, attached or pre-created by n3x:volumesOnly, or "" if there is none yet
+// (first deploy). EBS volumes cannot move between AZs, so a runner replaced
+// into another AZ would strand its cache volume.
+func existingCacheAz(ctx *pulumi.Context, volumeName string) (string, error) {
+	found, err := ebs.GetEbsVolumes(ctx, &ebs.GetEbsVolumesArgs{
+		Tags: map[string]string{"Project": "n3x", "Stack": ctx.Stack(), "Name": volumeName},
+		Filters: []ebs.GetEbsVolumesFilter{
+			{Name: "status", Values: []string{"in-use", "available"}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("volume %s lookup: %w", volumeName, err)
+	}
+	if len(found.Ids) == 0 {
+		return "", nil
+	}
+	vol, err := ebs.LookupVolume(ctx, &ebs.LookupVolumeArgs{
+		Filters: []ebs.GetVolumeFilter{
+			{Name: "volume-id", Values: found.Ids[:1]},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("volume %s: %w", found.Ids[0], err)
+	}
+	return vol.AvailabilityZone, nil
+}
+
+// selectSubnet returns the launch subnet of the i-th runner: round-robin
+// across subnets, or the first one with singleAz. A runner whose cache
+// volume already exists (cacheAz) moves to a subnet in that AZ; if none is
+// configured, the ConfigError names subnetKey (subnetId or subnetGroupTag).
+func selectSubnet(subnets []*ec2.LookupSubnetResult, i int, singleAz bool, cacheAz, runner, subnetKey string) (*ec2.LookupSubnetResult, error) {
+	subnet := subnets[0]
+	if !singleAz {
+		subnet = subnets[i%len(subnets)]
+	}
+	if cacheAz == "" || subnet.AvailabilityZone == cacheAz {
+		return subnet, nil
+	}
+	var pinned *ec2.LookupSubnetResult
+	for _, s := range subnets {
+		if s.AvailabilityZone == cacheAz {
+			pinned = s
+		}
+	}
+	if pinned == nil {
+		return nil, configErrorf(subnetKey, "add a subnet in "+cacheAz+", or snapshot the cache volume into n3x:cacheSnapshotId and delete it",
+			"runner %q: its cache volume is in %s, but no configured subnet is", runner, cacheAz)
+	}
+	return pinned, nil
+}
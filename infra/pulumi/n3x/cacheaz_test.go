@@ -0,0 +1,42 @@
+package n3x
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+)
+
+func TestSelectSubnet(t *testing.T) {
+	subnets := []*ec2.LookupSubnetResult{
+		{Id: "subnet-a", AvailabilityZone: "us-east-1a"},
+		{Id: "subnet-b", AvailabilityZone: "us-east-1b"},
+	}
+	tests := []struct {
+		name     string
+		i        int
+		singleAz bool
+		cacheAz  string
+		want     string // Subnet ID, or "" for a ConfigError
+	}{
+		{"round-robin", 1, false, "", "subnet-b"},
+		{"pinned to the cache volume's AZ", 1, false, "us-east-1a", "subnet-a"},
+		{"no subnet in the cache volume's AZ", 0, false, "us-east-1c", ""},
+		{"single AZ", 1, true, "", "subnet-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectSubnet(subnets, tt.i, tt.singleAz, tt.cacheAz, "x86", "subnetGroupTag")
+			if tt.want == "" {
+				var ce *ConfigError
+				if !errors.As(err, &ce) || ce.Key != "subnetGroupTag" {
+					t.Fatalf("got %v, %v; want a subnetGroupTag ConfigError", got, err)
+				}
+				return
+			}
+			if err != nil || got.Id != tt.want {
+				t.Fatalf("got %v, %v; want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package n3x
+
+import "encoding/json"
+
+// guestMountPoints are the in-guest mount points of the data volumes, as set
+// up by the nixos-runner modules (first-boot-format mounts the ZFS pool's
+// nix dataset at /nix; yocto-cache's default cacheMountPoint). The ccache
+// volume has no NixOS module and so no known mount point.
+var guestMountPoints = map[string]string{
+	"root":          "/",
+	"zfs-nix-store": "/nix",
+	"yocto-cache":   "/var/cache/yocto",
+}
+
+// cloudwatchAgentConfig returns a CloudWatch agent configuration collecting
+// disk usage for the given mount points (plus memory usage) under the
+// CWAgent namespace, dimensioned by instance ID.
+func cloudwatchAgentConfig(mountPoints []string) (string, error) {
+	config := map[string]any{
+		"agent": map[string]any{
+			"metrics_collection_interval": 60,
+		},
+		"metrics": map[string]any{
+			"namespace": "CWAgent",
+			"append_dimensions": map[string]string{
+				"InstanceId": "${aws:InstanceId}",
+			},
+			"metrics_collected": map[string]any{
+				"disk": map[string]any{
+					"measurement": []string{"used_percent", "inodes_free"},
+					"resources":   mountPoints,
+				},
+				"mem": map[string]any{
+					"measurement": []string{"mem_used_percent"},
+				},
+			},
+		},
+	}
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
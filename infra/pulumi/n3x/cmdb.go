@@ -0,0 +1,19 @@
+package n3x
+
+import "github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+
+// cmdbSchemaVersion identifies the layout of the cmdbExport host records.
+// Bump it whenever a field is added, renamed or removed so the CMDB
+// importer can detect the change.
+const cmdbSchemaVersion = "1"
+
+// cmdbHost renders one runner as a CMDB host record.
+func cmdbHost(hostname, ipAddress pulumi.StringInput, role, owner string) pulumi.Map {
+	return pulumi.Map{
+		"hostname":   hostname,
+		"ip_address": ipAddress,
+		"os":         pulumi.String("NixOS"),
+		"role":       pulumi.String(role),
+		"owner":      pulumi.String(owner),
+	}
+}
@@ -0,0 +1,53 @@
+package n3x
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sizeVcpus gives the vCPU count per instance size for the general-purpose,
+// compute and memory families (x86 and Graviton alike). Burstable t3/t3a/t4g
+// sizes up to large, and t2 medium and large, have 2 vCPUs; .metal sizes
+// vary and are skipped.
+var sizeVcpus = map[string]int{
+	"medium": 1, "large": 2, "xlarge": 4,
+}
+
+// instanceVcpus returns the vCPU count of instanceType, or false if its size
+// is not in the lookup table.
+func instanceVcpus(instanceType string) (int, bool) {
+	family, size, ok := strings.Cut(instanceType, ".")
+	if !ok {
+		return 0, false
+	}
+	switch family {
+	case "t3", "t3a", "t4g":
+		switch size {
+		case "nano", "micro", "small", "medium", "large":
+			return 2, true
+		}
+	case "t2":
+		switch size {
+		case "medium", "large":
+			return 2, true
+		}
+	}
+	if vcpus, ok := sizeVcpus[size]; ok {
+		return vcpus, true
+	}
+	// Nxlarge has 4N vCPUs (2xlarge = 8, 4xlarge = 16, ...)
+	if n, err := strconv.Atoi(strings.TrimSuffix(size, "xlarge")); err == nil && strings.HasSuffix(size, "xlarge") && n > 0 {
+		return 4 * n, true
+	}
+	return 0, false
+}
+
+// suggestedConcurrency returns a GitLab runner `concurrent` value for
+// instanceType: one job per divisor vCPUs, at least 1.
+func suggestedConcurrency(instanceType string, divisor int) (int, bool) {
+	vcpus, ok := instanceVcpus(instanceType)
+	if !ok {
+		return 0, false
+	}
+	return max(vcpus/divisor, 1), true
+}
@@ -0,0 +1,28 @@
+package n3x
+
+import "testing"
+
+func TestInstanceVcpus(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		want         int // 0 when unknown
+	}{
+		{"c6i.2xlarge", 8},
+		{"c7g.xlarge", 4},
+		{"m7i.large", 2},
+		{"m6g.medium", 1},
+		{"t3.micro", 2},
+		{"t4g.large", 2},
+		{"t2.medium", 2},
+		{"t2.large", 2},
+		{"t2.xlarge", 4},
+		{"c6i.metal", 0},
+		{"c6i", 0},
+	}
+	for _, tt := range tests {
+		got, ok := instanceVcpus(tt.instanceType)
+		if ok != (tt.want > 0) || got != tt.want {
+			t.Errorf("instanceVcpus(%q) = %d, %v; want %d", tt.instanceType, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package n3x
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// ConfigError reports an invalid or missing n3x configuration value, as
+// opposed to an AWS API or resource error. Wrapping tooling can match it
+// with errors.As.
+type ConfigError struct {
+	Key  string // Offending key without the n3x: namespace (e.g. "amiX86")
+	Hint string // How to fix it (optional)
+	Err  error  // What is wrong with the value
+}
+
+func (e *ConfigError) Error() string {
+	msg := fmt.Sprintf("n3x:%s: %v", e.Key, e.Err)
+	if e.Hint != "" {
+		msg += " (" + e.Hint + ")"
+	}
+	return msg
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf returns a ConfigError for key with a fmt.Errorf-formatted
+// cause (%w is supported).
+func configErrorf(key, hint, format string, args ...any) *ConfigError {
+	return &ConfigError{Key: key, Hint: hint, Err: fmt.Errorf(format, args...)}
+}
+
+// requireConfig returns the value of a required key, or a ConfigError
+// instead of the panic cfg.Require raises.
+func requireConfig(cfg *config.Config, key, hint string) (string, error) {
+	v := cfg.Get(key)
+	if v == "" {
+		return "", configErrorf(key, hint, "required configuration value is not set")
+	}
+	return v, nil
+}
+
+// requiredConfig lists the keys a default stack (x86_64 runner with a key
+// pair) cannot deploy without, as the commands that set them. It is exported
+// as a setup checklist for new stacks, and its commands double as the hints
+// of the matching missing-key errors; keep it in step with those checks.
+var requiredConfig = []struct{ key, command string }{
+	{"amiX86", "pulumi config set n3x:amiX86 <ami-id>"},
+	{"sshPublicKey", `pulumi config set n3x:sshPublicKey "<ssh-ed25519 AAAA...>"`},
+}
+
+// requiredConfigHint returns the setup command for key from requiredConfig.
+func requiredConfigHint(key string) string {
+	for _, r := range requiredConfig {
+		if r.key == key {
+			return r.command
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package n3x
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestConfigErrorf(t *testing.T) {
+	err := error(configErrorf("runnersFile", "check the path", "%w", fs.ErrNotExist))
+	var ce *ConfigError
+	if !errors.As(err, &ce) {
+		t.Fatalf("errors.As failed for %v", err)
+	}
+	if ce.Key != "runnersFile" || ce.Hint != "check the path" {
+		t.Errorf("got key %q hint %q", ce.Key, ce.Hint)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%v does not unwrap to fs.ErrNotExist", err)
+	}
+	if want := "n3x:runnersFile: file does not exist (check the path)"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestValidateRunnerSpecsConfigErrors(t *testing.T) {
+	x86 := RunnerSpec{Name: "x86", InstanceTypes: []string{"c6i.2xlarge"}, AmiId: "ami-1"}
+	graviton := RunnerSpec{Name: "graviton", InstanceTypes: []string{"c7g.2xlarge"}, AmiId: "ami-2"}
+	fromFile := RunnerSpec{Name: "x86", InstanceTypes: []string{"c6i.2xlarge"}, FromFile: true}
+
+	tests := []struct {
+		name  string
+		specs func() []RunnerSpec
+		key   string
+		hint  string
+		err   string // ConfigError.Err message
+	}{
+		{
+			name:  "built-in runner without AMI",
+			specs: func() []RunnerSpec { s := x86; s.AmiId = ""; return []RunnerSpec{s} },
+			key:   "amiX86",
+			hint:  "set n3x:amiX86",
+			err:   `runner "x86": no AMI`,
+		},
+		{
+			name:  "graviton runner without AMI",
+			specs: func() []RunnerSpec { s := graviton; s.AmiId = ""; return []RunnerSpec{x86, s} },
+			key:   "amiArm64",
+			hint:  "set n3x:amiArm64",
+			err:   `runner "graviton": no AMI`,
+		},
+		{
+			name:  "runnersFile entry without AMI",
+			specs: func() []RunnerSpec { return []RunnerSpec{fromFile} },
+			key:   "runnersFile",
+			hint:  "set ami, or n3x:amisByArch for its architecture",
+			err:   `runner "x86": no AMI`,
+		},
+		{
+			name: "mixed-architecture instance types",
+			specs: func() []RunnerSpec {
+				s := x86
+				s.InstanceTypes = []string{"c6i.2xlarge", "c7g.2xlarge"}
+				return []RunnerSpec{s}
+			},
+			key: "instanceTypesX86",
+			err: `runner "x86": instance type "c7g.2xlarge" is arm64 but "c6i.2xlarge" is x86_64; all fallbacks must share one architecture`,
+		},
+		{
+			name:  "malformed spot instance type",
+			specs: func() []RunnerSpec { s := graviton; s.SpotInstanceTypes = []string{"c7g"}; return []RunnerSpec{s} },
+			key:   "spotInstanceTypesGraviton",
+			err:   `runner "graviton": spotInstanceTypes: instance type "c7g": expected <family>.<size> (e.g. c6i.2xlarge)`,
+		},
+		{
+			name: "private IP with ENI",
+			specs: func() []RunnerSpec {
+				s := x86
+				s.PrivateIp, s.NetworkInterfaceId = "10.0.0.10", "eni-1"
+				return []RunnerSpec{s}
+			},
+			key:  "privateIp",
+			hint: "drop either privateIp or networkInterfaceId",
+			err:  `runner "x86": privateIp cannot be combined with networkInterfaceId (the ENI has its own address)`,
+		},
+		{
+			name: "private IP claimed twice",
+			specs: func() []RunnerSpec {
+				a, b := x86, graviton
+				a.PrivateIp, b.PrivateIp = "10.0.0.10", "10.0.0.10"
+				return []RunnerSpec{a, b}
+			},
+			key:  "privateIpGraviton",
+			hint: "give each runner its own address",
+			err:  `runners "x86" and "graviton" both use private IP 10.0.0.10`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRunnerSpecs(tt.specs())
+			var ce *ConfigError
+			if !errors.As(err, &ce) {
+				t.Fatalf("got %v, want a ConfigError", err)
+			}
+			if ce.Key != tt.key {
+				t.Errorf("Key = %q, want %q", ce.Key, tt.key)
+			}
+			if ce.Hint != tt.hint {
+				t.Errorf("Hint = %q, want %q", ce.Hint, tt.hint)
+			}
+			if got := errors.Unwrap(err); got == nil || got.Error() != tt.err {
+				t.Errorf("Err = %v, want %q", got, tt.err)
+			}
+		})
+	}
+}
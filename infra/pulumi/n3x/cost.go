@@ -0,0 +1,75 @@
+package n3x
+
+import (
+	"math"
+	"strings"
+)
+
+// hoursPerMonth is the AWS pricing convention for a month (8760 h / 12).
+const hoursPerMonth = 730
+
+// xlargeHourlyUsd is the Linux on-demand price per hour of the .xlarge size
+// of common instance families (us-east-1, approximate). Other sizes scale
+// linearly with sizeFactor, which matches AWS pricing within a family.
+var xlargeHourlyUsd = map[string]float64{
+	"c5": 0.17, "c5a": 0.154, "c6a": 0.153, "c6i": 0.17, "c7a": 0.2053, "c7i": 0.1785,
+	"c6g": 0.136, "c7g": 0.145, "c8g": 0.1595,
+	"m5": 0.192, "m5a": 0.172, "m6a": 0.1728, "m6i": 0.192, "m7a": 0.2318, "m7i": 0.2016,
+	"m6g": 0.154, "m7g": 0.1632, "m8g": 0.1795,
+	"r5": 0.252, "r6a": 0.2268, "r6i": 0.252, "r7i": 0.2646,
+	"r6g": 0.2016, "r7g": 0.2142,
+	"t3": 0.1664, "t3a": 0.1504, "t4g": 0.1344,
+}
+
+// sizeFactor gives an instance size's multiple of .xlarge.
+var sizeFactor = map[string]float64{
+	"medium": 0.25, "large": 0.5, "xlarge": 1, "2xlarge": 2, "3xlarge": 3,
+	"4xlarge": 4, "8xlarge": 8, "12xlarge": 12, "16xlarge": 16,
+	"24xlarge": 24, "32xlarge": 32, "48xlarge": 48,
+}
+
+// ebsGbMonthUsd is the EBS storage price per GB-month by volume type
+// (us-east-1, approximate).
+var ebsGbMonthUsd = map[string]float64{
+	"gp3": 0.08, "gp2": 0.10, "io1": 0.125, "io2": 0.125,
+	"st1": 0.045, "sc1": 0.015, "standard": 0.05,
+}
+
+// costEstimate accumulates an approximate monthly cost of the stack's
+// instances and EBS volumes at us-east-1 on-demand list prices. It leaves
+// out data transfer, snapshots, load balancers, other regions' prices and
+// discounts (spot, savings plans), so it is meant for comparing changes, not
+// for billing.
+type costEstimate struct {
+	monthlyUsd float64
+	unpriced   []string // Instance types missing from xlargeHourlyUsd
+}
+
+// addInstance adds an instance running all month.
+func (c *costEstimate) addInstance(instanceType string) {
+	family, size, _ := strings.Cut(instanceType, ".")
+	hourly, ok := xlargeHourlyUsd[family]
+	factor, sized := sizeFactor[size]
+	if !ok || !sized {
+		c.unpriced = append(c.unpriced, instanceType)
+		return
+	}
+	c.monthlyUsd += hourly * factor * hoursPerMonth
+}
+
+// addVolume adds an EBS volume with its effective IOPS and throughput; gp3
+// performance above the baseline and io1/io2 IOPS are billed on top.
+func (c *costEstimate) addVolume(volumeType string, sizeGb, iops, throughput int) {
+	c.monthlyUsd += ebsGbMonthUsd[volumeType] * float64(sizeGb)
+	switch volumeType {
+	case "gp3":
+		c.monthlyUsd += 0.005*float64(max(iops-3000, 0)) + 0.04*float64(max(throughput-125, 0))
+	case "io1", "io2":
+		c.monthlyUsd += 0.065 * float64(iops)
+	}
+}
+
+// usd rounds an amount to cents.
+func usd(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,50 @@
+package n3x
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// runnerDashboardBody returns the CloudWatch dashboard JSON for one runner
+// instance: CPU, network and EBS (Nitro instance-level) metrics at 5-minute
+// resolution.
+func runnerDashboardBody(region, instanceId string) (string, error) {
+	widget := func(x, y int, title string, metrics ...string) map[string]any {
+		var series []any
+		for _, m := range metrics {
+			series = append(series, []string{"AWS/EC2", m, "InstanceId", instanceId})
+		}
+		return map[string]any{
+			"type":   "metric",
+			"x":      x,
+			"y":      y,
+			"width":  12,
+			"height": 6,
+			"properties": map[string]any{
+				"title":   title,
+				"region":  region,
+				"metrics": series,
+				"stat":    "Average",
+				"period":  300,
+				"view":    "timeSeries",
+			},
+		}
+	}
+	body, err := json.Marshal(map[string]any{
+		"widgets": []any{
+			widget(0, 0, "CPU utilization (%)", "CPUUtilization"),
+			widget(12, 0, "Network (bytes)", "NetworkIn", "NetworkOut"),
+			widget(0, 6, "EBS throughput (bytes)", "EBSReadBytes", "EBSWriteBytes"),
+			widget(12, 6, "EBS operations", "EBSReadOps", "EBSWriteOps"),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("dashboard body: %w", err)
+	}
+	return string(body), nil
+}
+
+// dashboardUrl returns the CloudWatch console URL of a dashboard.
+func dashboardUrl(region, name string) string {
+	return fmt.Sprintf("https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#dashboards:name=%s", region, region, name)
+}
@@ -0,0 +1,60 @@
+package n3x
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// normalizeDeviceName converts an EBS attachment device name to the
+// /dev/sd[f-p] form AWS recommends for additional volumes. Accepts the
+// short ("sdf", "xvdf") and Xen ("/dev/xvdf") spellings users commonly pass.
+func normalizeDeviceName(name string) (string, error) {
+	n := strings.TrimPrefix(strings.TrimSpace(name), "/dev/")
+	switch {
+	case strings.HasPrefix(n, "xvd"):
+		n = strings.TrimPrefix(n, "xvd")
+	case strings.HasPrefix(n, "sd"):
+		n = strings.TrimPrefix(n, "sd")
+	default:
+		return "", fmt.Errorf("device name %q: expected /dev/sd[f-p] (sdX, xvdX and /dev/xvdX are also accepted)", name)
+	}
+	if len(n) != 1 || n[0] < 'f' || n[0] > 'p' {
+		return "", fmt.Errorf("device name %q: letter must be f through p (/dev/sdf../dev/sdp)", name)
+	}
+	return "/dev/sd" + n, nil
+}
+
+// guestDevicePaths returns the block device each volume is expected at inside
+// the guest, keyed by purpose, given the root device and the data volumes'
+// attachment device names (purpose → /dev/sdX). On Nitro instances EBS
+// volumes are NVMe namespaces: root is /dev/nvme0n1 and data volumes follow
+// in attachment order, taken to be device-letter order. On Xen instances
+// /dev/sdX appears as /dev/xvdX.
+func guestDevicePaths(nitro bool, rootDevice string, attachments map[string]string) map[string]string {
+	purposes := make([]string, 0, len(attachments))
+	for p := range attachments {
+		purposes = append(purposes, p)
+	}
+	sort.Slice(purposes, func(i, j int) bool { return attachments[purposes[i]] < attachments[purposes[j]] })
+
+	paths := map[string]string{}
+	if nitro {
+		paths["root"] = "/dev/nvme0n1"
+		for i, p := range purposes {
+			paths[p] = fmt.Sprintf("/dev/nvme%dn1", i+1)
+		}
+		return paths
+	}
+	xen := func(dev string) string {
+		if rest, ok := strings.CutPrefix(dev, "/dev/sd"); ok {
+			return "/dev/xvd" + rest
+		}
+		return dev
+	}
+	paths["root"] = xen(rootDevice)
+	for _, p := range purposes {
+		paths[p] = xen(attachments[p])
+	}
+	return paths
+}
@@ -0,0 +1,36 @@
+package n3x
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDeviceName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // Normalized name, or "" for an error
+		err  string // Substring of the error
+	}{
+		{"sdf", "/dev/sdf", ""},
+		{"/dev/sdf", "/dev/sdf", ""},
+		{"xvdf", "/dev/sdf", ""},
+		{"/dev/xvdf", "/dev/sdf", ""},
+		{" /dev/sdp ", "/dev/sdp", ""},
+		{"sdq", "", "letter must be f through p"},
+		{"sda1", "", "letter must be f through p"},
+		{"", "", "expected /dev/sd[f-p]"},
+		{"/dev/nvme1n1", "", "expected /dev/sd[f-p]"},
+	}
+	for _, tt := range tests {
+		got, err := normalizeDeviceName(tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("normalizeDeviceName(%q) = %q, %v; want an error containing %q", tt.name, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeDeviceName(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
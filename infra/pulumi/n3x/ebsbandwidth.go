@@ -0,0 +1,56 @@
+package n3x
+
+import "strings"
+
+// ebsBaselineMbps gives the baseline (sustained) EBS bandwidth in Mbps per
+// size for families sharing the same EBS profile. Smaller sizes can burst
+// above their baseline for about 30 minutes a day; long builds run at baseline.
+var ebsBaselineMbps = []struct {
+	families []string
+	sizes    map[string]int
+}{
+	{
+		// Intel Ice Lake / AMD Milan (6th generation x86)
+		families: []string{"c6i", "m6i", "r6i", "c6a", "m6a", "r6a", "c6id", "m6id", "r6id"},
+		sizes: map[string]int{
+			"large": 650, "xlarge": 1250, "2xlarge": 2500, "4xlarge": 5000,
+			"8xlarge": 10000, "12xlarge": 15000, "16xlarge": 20000,
+			"24xlarge": 30000, "32xlarge": 40000,
+		},
+	},
+	{
+		// Graviton3
+		families: []string{"c7g", "m7g", "r7g", "c7gd", "m7gd", "r7gd"},
+		sizes: map[string]int{
+			"medium": 315, "large": 630, "xlarge": 1250, "2xlarge": 2500,
+			"4xlarge": 4750, "8xlarge": 9500, "12xlarge": 14250, "16xlarge": 19000,
+		},
+	},
+	{
+		// Graviton2
+		families: []string{"c6g", "m6g", "r6g", "c6gd", "m6gd", "r6gd"},
+		sizes: map[string]int{
+			"medium": 315, "large": 630, "xlarge": 1188, "2xlarge": 2375,
+			"4xlarge": 4750, "8xlarge": 9500, "12xlarge": 14250, "16xlarge": 19000,
+		},
+	},
+}
+
+// ebsBandwidthMBps returns the baseline EBS bandwidth of instanceType in MB/s,
+// or false for types missing from the lookup table.
+func ebsBandwidthMBps(instanceType string) (int, bool) {
+	family, size, ok := strings.Cut(instanceType, ".")
+	if !ok {
+		return 0, false
+	}
+	for _, entry := range ebsBaselineMbps {
+		for _, f := range entry.families {
+			if f != family {
+				continue
+			}
+			mbps, ok := entry.sizes[size]
+			return mbps / 8, ok
+		}
+	}
+	return 0, false
+}
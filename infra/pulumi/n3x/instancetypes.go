@@ -0,0 +1,284 @@
+package n3x
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// instanceTypePattern matches EC2 instance type names: a family (class letters,
+// generation digit, optional attributes/suffix such as "gd" or "i-flex") and a
+// size.
+var instanceTypePattern = regexp.MustCompile(`^([a-z]+)-?([0-9]+)([a-z0-9-]*)\.([0-9a-z]+)$`)
+
+// instanceArchitecture infers the CPU architecture ("x86_64" or "arm64") from
+// an instance type name. Graviton families carry a "g" attribute after the
+// generation digit (c7g, m6gd, t4g, im4gn, g5g) — plus the original a1; the
+// Apple silicon Macs are mac2 and its suffixed variants (mac2-m2pro), while
+// mac1 is Intel. Everything else is x86_64.
+func instanceArchitecture(instanceType string) (string, error) {
+	m := instanceTypePattern.FindStringSubmatch(instanceType)
+	if m == nil {
+		return "", fmt.Errorf("instance type %q: expected <family>.<size> (e.g. c6i.2xlarge)", instanceType)
+	}
+	// Only the attributes before a suffix count: the "m2" of mac2-m2 is a
+	// chip name, not a family attribute
+	attributes, _, _ := strings.Cut(m[3], "-")
+	switch {
+	case m[1] == "mac":
+		if m[2] != "1" {
+			return "arm64", nil
+		}
+	case strings.Contains(attributes, "g"), m[1] == "a" && m[2] == "1":
+		return "arm64", nil
+	}
+	return "x86_64", nil
+}
+
+// validateInstanceTypes checks an ordered instance-type preference list: it
+// must be non-empty, well-formed, free of duplicates and single-architecture
+// (every entry has to boot the same AMI).
+func validateInstanceTypes(types []string) error {
+	if len(types) == 0 {
+		return fmt.Errorf("at least one instance type is required")
+	}
+	seen := map[string]bool{}
+	var arch string
+	for _, t := range types {
+		if seen[t] {
+			return fmt.Errorf("instance type %q listed more than once", t)
+		}
+		seen[t] = true
+
+		a, err := instanceArchitecture(t)
+		if err != nil {
+			return err
+		}
+		if arch == "" {
+			arch = a
+		} else if a != arch {
+			return fmt.Errorf("instance type %q is %s but %q is %s; all fallbacks must share one architecture", t, a, types[0], arch)
+		}
+	}
+	return nil
+}
+
+// requireArchitecture returns an error unless instanceType is a want
+// ("x86_64" or "arm64") instance type.
+func requireArchitecture(instanceType, want string) error {
+	arch, err := instanceArchitecture(instanceType)
+	if err != nil {
+		return err
+	}
+	if arch != want {
+		return fmt.Errorf("instance type %q is %s, not %s", instanceType, arch, want)
+	}
+	return nil
+}
+
+// requireGravitonType returns a ConfigError unless the Graviton runner's
+// instance type is arm64, which an arm64 AMI (n3x:amiArm64) needs to boot.
+func requireGravitonType(instanceType string) error {
+	if err := requireArchitecture(instanceType, "arm64"); err != nil {
+		return configErrorf("instanceTypeGraviton", "use an arm64 family such as c7g", "n3x:amiArm64 is set but %w", err)
+	}
+	return nil
+}
+
+// checkInstanceTypeOfferings verifies that every instance type is offered in
+// the stack's region, so an unavailable type fails at preview instead of at
+// RunInstances. Missing types are reported with the same-class, same-size
+// types (and same architecture) the region does offer.
+func checkInstanceTypeOfferings(ctx *pulumi.Context, types []string) error {
+	offered, err := ec2.GetInstanceTypeOfferings(ctx, &ec2.GetInstanceTypeOfferingsArgs{
+		Filters: []ec2.GetInstanceTypeOfferingsFilter{
+			{Name: "instance-type", Values: types},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("instance type offerings: %w", err)
+	}
+	available := map[string]bool{}
+	for _, t := range offered.InstanceTypes {
+		available[t] = true
+	}
+
+	var missing []string
+	for _, t := range types {
+		if !available[t] {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var details []string
+	for _, t := range missing {
+		alternatives, err := offeredAlternatives(ctx, t)
+		if err != nil {
+			return err
+		}
+		if len(alternatives) == 0 {
+			details = append(details, t)
+			continue
+		}
+		details = append(details, fmt.Sprintf("%s (offered: %s)", t, strings.Join(alternatives, ", ")))
+	}
+	return fmt.Errorf("instance types not offered in this region: %s", strings.Join(details, "; "))
+}
+
+// offeredAlternatives lists region-offered instance types of the same class
+// letter, size and architecture as instanceType (c7i.2xlarge for c6i.2xlarge).
+func offeredAlternatives(ctx *pulumi.Context, instanceType string) ([]string, error) {
+	m := instanceTypePattern.FindStringSubmatch(instanceType)
+	arch, err := instanceArchitecture(instanceType)
+	if err != nil {
+		return nil, err
+	}
+	offered, err := ec2.GetInstanceTypeOfferings(ctx, &ec2.GetInstanceTypeOfferingsArgs{
+		Filters: []ec2.GetInstanceTypeOfferingsFilter{
+			{Name: "instance-type", Values: []string{fmt.Sprintf("%s*.%s", m[1], m[4])}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("instance type offerings for %s: %w", instanceType, err)
+	}
+	var alternatives []string
+	for _, t := range offered.InstanceTypes {
+		// The wildcard also matches longer class names (c* → cr1); keep exact class
+		if a := instanceTypePattern.FindStringSubmatch(t); a == nil || a[1] != m[1] {
+			continue
+		}
+		if a, err := instanceArchitecture(t); err == nil && a == arch {
+			alternatives = append(alternatives, t)
+		}
+	}
+	sort.Strings(alternatives)
+	return alternatives, nil
+}
+
+// instanceHypervisor returns the hypervisor of instanceType ("nitro" or
+// "xen"), reporting bare metal types as "nitro".
+func instanceHypervisor(ctx *pulumi.Context, instanceType string) (string, error) {
+	info, err := ec2.GetInstanceType(ctx, &ec2.GetInstanceTypeArgs{InstanceType: instanceType})
+	if err != nil {
+		return "", fmt.Errorf("instance type %s: %w", instanceType, err)
+	}
+	if info.BareMetal {
+		return "nitro", nil
+	}
+	return info.Hypervisor, nil
+}
+
+// requireNitro returns an error unless instanceType runs on the Nitro system
+// (virtualized or bare metal), as io2 Multi-Attach requires.
+func requireNitro(ctx *pulumi.Context, instanceType string) error {
+	hypervisor, err := instanceHypervisor(ctx, instanceType)
+	if err != nil {
+		return err
+	}
+	if hypervisor != "nitro" {
+		return fmt.Errorf("instance type %s is not Nitro-based (hypervisor %q)", instanceType, hypervisor)
+	}
+	return nil
+}
+
+// enclaveUnsupportedFamilies are Nitro-based families without Nitro Enclaves
+// support.
+var enclaveUnsupportedFamilies = map[string]bool{
+	"t3": true, "t3a": true, "t4g": true, "a1": true,
+	"c7i-flex": true, "m7i-flex": true, "mac1": true, "mac2": true,
+}
+
+// capacityBlockFamilies are the families sold as EC2 Capacity Blocks for ML.
+var capacityBlockFamilies = map[string]bool{
+	"p4d": true, "p4de": true, "p5": true, "p5e": true, "p5en": true,
+	"p6-b200": true, "trn1": true, "trn2": true,
+}
+
+// requireCapacityBlockSupport returns an error unless instanceType can be
+// launched into a Capacity Block.
+func requireCapacityBlockSupport(instanceType string) error {
+	family, _, _ := strings.Cut(instanceType, ".")
+	if !capacityBlockFamilies[family] {
+		return fmt.Errorf("instance type %s is not offered as a Capacity Block", instanceType)
+	}
+	return nil
+}
+
+// requireEnclaveSupport returns an error unless instanceType can run Nitro
+// Enclaves: a Nitro type outside the unsupported families with enough vCPUs
+// to donate to the enclave (at least 4 on x86_64, 2 on Graviton).
+func requireEnclaveSupport(ctx *pulumi.Context, instanceType string) error {
+	family, _, _ := strings.Cut(instanceType, ".")
+	if enclaveUnsupportedFamilies[family] {
+		return fmt.Errorf("instance type %s does not support Nitro Enclaves", instanceType)
+	}
+	info, err := ec2.GetInstanceType(ctx, &ec2.GetInstanceTypeArgs{InstanceType: instanceType})
+	if err != nil {
+		return fmt.Errorf("instance type %s: %w", instanceType, err)
+	}
+	if info.Hypervisor != "nitro" && !info.BareMetal {
+		return fmt.Errorf("instance type %s is not Nitro-based (hypervisor %q)", instanceType, info.Hypervisor)
+	}
+	arch, err := instanceArchitecture(instanceType)
+	if err != nil {
+		return err
+	}
+	minVcpus := 4
+	if arch == "arm64" {
+		minVcpus = 2
+	}
+	if info.DefaultVcpus < minVcpus {
+		return fmt.Errorf("instance type %s has %d vCPUs; Nitro Enclaves need at least %d on %s", instanceType, info.DefaultVcpus, minVcpus, arch)
+	}
+	return nil
+}
+
+// instanceTypeAllowed reports whether instanceType matches one of the
+// allowlist entries (exact types or path.Match globs such as "c6i.*").
+func instanceTypeAllowed(instanceType string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, instanceType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isBurstable reports whether instanceType is a burstable (CPU credit) type:
+// the t2, t3, t3a and t4g families.
+func isBurstable(instanceType string) bool {
+	m := instanceTypePattern.FindStringSubmatch(instanceType)
+	return m != nil && m[1] == "t"
+}
+
+// describeAmi returns the CPU architecture ("x86_64" or "arm64"), root
+// device name and creation time recorded on an AMI. Deprecated AMIs are
+// included so pinned images keep resolving.
+func describeAmi(ctx *pulumi.Context, amiId string) (arch, rootDeviceName string, created time.Time, err error) {
+	ami, err := ec2.LookupAmi(ctx, &ec2.LookupAmiArgs{
+		Filters: []ec2.GetAmiFilter{
+			{Name: "image-id", Values: []string{amiId}},
+		},
+		IncludeDeprecated: pulumi.BoolRef(true),
+	})
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("AMI %s: %w", amiId, err)
+	}
+	if ami.Architecture != "x86_64" && ami.Architecture != "arm64" {
+		return "", "", time.Time{}, fmt.Errorf("AMI %s: unsupported architecture %q", amiId, ami.Architecture)
+	}
+	created, err = time.Parse(time.RFC3339, ami.CreationDate)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("AMI %s: creation date: %w", amiId, err)
+	}
+	return ami.Architecture, ami.RootDeviceName, created, nil
+}
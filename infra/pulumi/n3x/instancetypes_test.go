@@ -0,0 +1,55 @@
+package n3x
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstanceArchitecture(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		want         string // "" for an error
+	}{
+		{"a1.xlarge", "arm64"},
+		{"c7g.2xlarge", "arm64"},
+		{"c7gn.2xlarge", "arm64"},
+		{"m6gd.large", "arm64"},
+		{"g5g.xlarge", "arm64"},
+		{"m7i.2xlarge", "x86_64"},
+		{"m7i-flex.large", "x86_64"},
+		{"g5.xlarge", "x86_64"},
+		{"mac1.metal", "x86_64"},
+		{"mac2.metal", "arm64"},
+		{"mac2-m2.metal", "arm64"},
+		{"mac2-m2pro.metal", "arm64"},
+		{"c7g", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := instanceArchitecture(tt.instanceType)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("instanceArchitecture(%q) = %q, want an error", tt.instanceType, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("instanceArchitecture(%q) = %q, %v; want %q", tt.instanceType, got, err, tt.want)
+		}
+	}
+}
+
+func TestRequireGravitonType(t *testing.T) {
+	if err := requireGravitonType("c7g.2xlarge"); err != nil {
+		t.Errorf("c7g.2xlarge: %v", err)
+	}
+	err := requireGravitonType("c6i.2xlarge")
+	if err == nil {
+		t.Fatal("c6i.2xlarge: want an error")
+	}
+	for _, key := range []string{"amiArm64", "instanceTypeGraviton"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("%q does not name %s", err, key)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package n3x
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// formatInventory renders a human-readable, diff-friendly inventory of the
+// resolved runners: one "runner.attribute: value" line per fact, sorted so
+// that committing the output to git shows exactly what changed.
+func formatInventory(specs []RunnerSpec, volumes func(RunnerSpec) []plannedVolume) string {
+	lines := map[string]string{}
+	for _, spec := range specs {
+		role := "build"
+		if spec.Role == RoleCache {
+			role = "cache"
+		}
+		lines[spec.Name+".role"] = role
+		lines[spec.Name+".ami"] = spec.AmiId
+		lines[spec.Name+".instanceType"] = spec.InstanceTypes[0]
+		if len(spec.InstanceTypes) > 1 {
+			lines[spec.Name+".instanceTypeFallbacks"] = strings.Join(spec.InstanceTypes[1:], ", ")
+		}
+		for _, v := range volumes(spec) {
+			lines[spec.Name+".volume."+v.purpose] = fmt.Sprintf("%d GB %s", v.sizeGb, v.settings.VolumeType)
+		}
+	}
+
+	keys := make([]string, 0, len(lines))
+	for k := range lines {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", k, lines[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package n3x
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kms"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// defaultEbsKeyAlias is the AWS-managed key EBS encrypts with when no
+// customer-managed key is given.
+const defaultEbsKeyAlias = "alias/aws/ebs"
+
+// checkEbsKmsKey returns an error unless keyId (key ID, ARN or alias) names
+// an enabled, symmetric encryption key in region. EBS only reports a
+// cross-region or disabled key when the volume is created, and a key ARN
+// from another region is otherwise easy to miss.
+func checkEbsKmsKey(ctx *pulumi.Context, keyId, region string) error {
+	key, err := kms.LookupKey(ctx, &kms.LookupKeyArgs{KeyId: keyId})
+	if err != nil {
+		return fmt.Errorf("KMS key %s not found in %s (keys are regional; use a key or multi-Region replica in %s): %w", keyId, region, region, err)
+	}
+	// arn:<partition>:kms:<region>:<account>:key/<id>
+	if parts := strings.Split(key.Arn, ":"); len(parts) > 3 && parts[3] != region {
+		return fmt.Errorf("KMS key %s is in %s, not %s (use a key or multi-Region replica in %s)", keyId, parts[3], region, region)
+	}
+	if !key.Enabled || key.KeyState != "Enabled" {
+		return fmt.Errorf("KMS key %s is not enabled (state %s)", keyId, key.KeyState)
+	}
+	if key.KeyUsage != "ENCRYPT_DECRYPT" || key.KeySpec != "SYMMETRIC_DEFAULT" {
+		return fmt.Errorf("KMS key %s is %s/%s; EBS needs a symmetric ENCRYPT_DECRYPT key", keyId, key.KeySpec, key.KeyUsage)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package n3x
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Upstream binary cache and its signing key, kept in the snippet so
+// consumers replacing their substituters keep cache.nixos.org.
+const (
+	nixosCacheUrl = "https://cache.nixos.org"
+	nixosCacheKey = "cache.nixos.org-1:6NCHdD59X431o0gWypbMrAURkbJ16ZPMQFGspcDShjY="
+)
+
+// nixPublicKey returns the public key of a Nix signing secret key
+// ("<name>:<base64 ed25519 key>", as from nix key generate-secret), like
+// nix key convert-secret-to-public. Errors never include the secret.
+func nixPublicKey(secretKey string) (string, error) {
+	name, encoded, ok := strings.Cut(strings.TrimSpace(secretKey), ":")
+	if !ok || name == "" {
+		return "", errors.New("not a Nix signing key (<name>:<key>)")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 64 {
+		return "", errors.New("not a Nix signing key (expected a base64 64-byte ed25519 secret key)")
+	}
+	// An ed25519 secret key is the seed followed by the public key
+	return name + ":" + base64.StdEncoding.EncodeToString(key[32:]), nil
+}
+
+// nixConfigSnippet renders nix.conf substituters/trusted-public-keys lines for
+// the runner caches at urls, all signed with publicKey.
+func nixConfigSnippet(urls []string, publicKey string) string {
+	return fmt.Sprintf("substituters = %s %s\ntrusted-public-keys = %s %s\n",
+		strings.Join(urls, " "), nixosCacheUrl, publicKey, nixosCacheKey)
+}
@@ -0,0 +1,32 @@
+package n3x
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// checkPrivateIp verifies that ip is an assignable IPv4 address in the
+// subnet cidr. AWS reserves the first four addresses and the last address of
+// every subnet.
+func checkPrivateIp(ip, cidr string) error {
+	addr := net.ParseIP(ip).To4()
+	if addr == nil {
+		return fmt.Errorf("private IP %q: expected an IPv4 address", ip)
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("subnet CIDR %q: %w", cidr, err)
+	}
+	if !subnet.Contains(addr) {
+		return fmt.Errorf("private IP %s is outside subnet %s", ip, cidr)
+	}
+
+	ones, bits := subnet.Mask.Size()
+	offset := binary.BigEndian.Uint32(addr) - binary.BigEndian.Uint32(subnet.IP.To4())
+	last := uint32(1)<<(bits-ones) - 1
+	if offset < 4 || offset == last {
+		return fmt.Errorf("private IP %s is reserved by AWS in subnet %s (first four and last addresses)", ip, cidr)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package n3x
+
+import (
+	"sort"
+	"strings"
+)
+
+// sizingProfile is a coherent bundle of defaults selected via n3x:profile.
+// Individual config keys (instanceTypeX86, cacheVolumeSize, ...) still override
+// any field.
+type sizingProfile struct {
+	instanceTypeX86      string
+	instanceTypeGraviton string
+	rootVolumeSize       int  // GB
+	cacheVolumeSize      int  // GB
+	yoctoVolumeSize      int  // GB
+	detailedMonitoring   bool // 1-minute CloudWatch metrics (billed)
+	alarms               bool // Per-runner status check alarms
+}
+
+// sizingProfiles maps n3x:profile to its defaults. The unset profile ("")
+// keeps the original single-stack defaults.
+//
+//	profile  | x86         | graviton    | root | cache | yocto | monitoring | alarms
+//	---------+-------------+-------------+------+-------+-------+------------+-------
+//	(unset)  | c6i.2xlarge | c7g.2xlarge |   50 |   500 |   100 | off        | off
+//	dev      | c6i.xlarge  | c7g.xlarge  |   30 |   100 |    50 | off        | off
+//	staging  | c6i.2xlarge | c7g.2xlarge |   50 |   250 |   100 | off        | on
+//	prod     | c6i.4xlarge | c7g.4xlarge |  100 |  1000 |   200 | on         | on
+var sizingProfiles = map[string]sizingProfile{
+	"": {
+		instanceTypeX86:      "c6i.2xlarge",
+		instanceTypeGraviton: "c7g.2xlarge",
+		rootVolumeSize:       50,
+		cacheVolumeSize:      500,
+		yoctoVolumeSize:      100,
+	},
+	"dev": {
+		instanceTypeX86:      "c6i.xlarge",
+		instanceTypeGraviton: "c7g.xlarge",
+		rootVolumeSize:       30,
+		cacheVolumeSize:      100,
+		yoctoVolumeSize:      50,
+	},
+	"staging": {
+		instanceTypeX86:      "c6i.2xlarge",
+		instanceTypeGraviton: "c7g.2xlarge",
+		rootVolumeSize:       50,
+		cacheVolumeSize:      250,
+		yoctoVolumeSize:      100,
+		alarms:               true,
+	},
+	"prod": {
+		instanceTypeX86:      "c6i.4xlarge",
+		instanceTypeGraviton: "c7g.4xlarge",
+		rootVolumeSize:       100,
+		cacheVolumeSize:      1000,
+		yoctoVolumeSize:      200,
+		detailedMonitoring:   true,
+		alarms:               true,
+	},
+}
+
+// lookupProfile returns the sizing profile for name, or a ConfigError listing
+// the valid profile names.
+func lookupProfile(name string) (sizingProfile, error) {
+	p, ok := sizingProfiles[name]
+	if !ok {
+		var names []string
+		for n := range sizingProfiles {
+			if n != "" {
+				names = append(names, n)
+			}
+		}
+		sort.Strings(names)
+		return sizingProfile{}, configErrorf("profile", "use one of "+strings.Join(names, ", "), "unknown profile %q", name)
+	}
+	return p, nil
+}
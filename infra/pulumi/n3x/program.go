@@ -0,0 +1,3043 @@
+package n3x
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/acm"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ebs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2transitgateway"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/efs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lb"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/outposts"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/resourcegroups"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/route53"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sqs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi/config"
+)
+
+// resolveDeviceName reads an attachment device name from key (falling back to
+// def) and normalizes it to the /dev/sd[f-p] form.
+func resolveDeviceName(cfg *config.Config, key, def string) (string, error) {
+	name := cfg.Get(key)
+	if name == "" {
+		name = def
+	}
+	dev, err := normalizeDeviceName(name)
+	if err != nil {
+		return "", configErrorf(key, "", "%w", err)
+	}
+	return dev, nil
+}
+
+// resolveInstanceTypes returns the ordered instance-type list for a runner:
+// listKey if set (its first entry must agree with singleKey when both are
+// set), otherwise just the resolved single type.
+func resolveInstanceTypes(cfg *config.Config, listKey, singleKey, single string) ([]string, error) {
+	var types []string
+	if err := cfg.GetObject(listKey, &types); err != nil {
+		return nil, configErrorf(listKey, "", "%w", err)
+	}
+	if len(types) == 0 {
+		types = []string{single}
+	} else if explicit := cfg.Get(singleKey); explicit != "" && explicit != types[0] {
+		return nil, configErrorf(singleKey, "make it the first entry of n3x:"+listKey+" or unset it", "%s conflicts with the first entry of n3x:%s (%s)", explicit, listKey, types[0])
+	}
+	if err := validateInstanceTypes(types); err != nil {
+		return nil, configErrorf(listKey, "", "%w", err)
+	}
+	return types, nil
+}
+
+// namePrefixPattern restricts n3x:namePrefix to characters valid in every
+// AWS name it is embedded in (key pair, alarm, Name tags).
+var namePrefixPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,31}$`)
+
+// efsMountPathPattern keeps n3x:efsMountPath safe to use unquoted in the
+// user-data script.
+var efsMountPathPattern = regexp.MustCompile(`^/[A-Za-z0-9/_.-]+$`)
+
+// maxUserDataBytes is EC2's user-data limit (16 KB, before base64 encoding).
+const maxUserDataBytes = 16 * 1024
+
+// ec2AssumeRolePolicy is the trust policy of the runners' instance role.
+const ec2AssumeRolePolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "ec2.amazonaws.com"},
+    "Action": "sts:AssumeRole"
+  }]
+}`
+
+// jobQueueAccessPolicy lets the runner role consume (and re-queue) build
+// jobs from the queue whose ARN is substituted for %s.
+const jobQueueAccessPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Action": [
+      "sqs:ReceiveMessage",
+      "sqs:DeleteMessage",
+      "sqs:ChangeMessageVisibility",
+      "sqs:SendMessage",
+      "sqs:GetQueueAttributes",
+      "sqs:GetQueueUrl"
+    ],
+    "Resource": "%s"
+  }]
+}`
+
+// policyName returns the name of an IAM policy from its ARN (the last path
+// segment).
+func policyName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// policyAttachmentName returns the resource name of the runner role's
+// attachment of the policy arn. The policy name alone is not unique (an
+// AWS-managed and a customer-managed policy, or policies under different
+// paths, can share it), so a hash of the full ARN is appended.
+func policyAttachmentName(arn string) string {
+	sum := sha256.Sum256([]byte(arn))
+	return fmt.Sprintf("n3x-runner-role-%s-%x", policyName(arn), sum[:4])
+}
+
+// RunnerSpec defines per-runner configuration for CreateRunner.
+type RunnerSpec struct {
+	Name          string   // Resource name prefix (e.g., "x86", "graviton")
+	InstanceTypes []string // EC2 instance types in preference order; [0] is launched
+	AmiId         string   // Pre-registered NixOS AMI ID
+
+	NetworkInterfaceId string   // Existing ENI attached as the primary interface (optional)
+	GitlabTags         []string // GitLab runner tags jobs are routed by (e.g. "nix", "aarch64")
+	PrivateIp          string   // Fixed private IPv4 address in the launch subnet (optional)
+	SubnetId           string   // Launch subnet, assigned from n3x:subnetId or n3x:subnetGroupTag
+	Architecture       string   // "x86_64" or "arm64", detected from the AMI (runnersFile may declare it)
+	RootDeviceName     string   // AMI root device (e.g. /dev/xvda), detected from the AMI or n3x:rootDeviceName
+	AmiAgeDays         int      // Whole days since the AMI was created, detected from the AMI
+	AvailabilityZone   string   // Pinned AZ of an existing cache volume (default VPC only)
+	VolumeAz           string   // AZ of the data volumes when known before launch (subnet or pinned AZ)
+	UserData           string   // Script lines appended to the base user data (optional)
+	SpotInstanceTypes  []string // Spot types the multi-arch ASG diversifies over (optional)
+	Ephemeral          bool     // Temporary runner that terminates itself after TtlHours
+	TtlHours           int      // Hours from boot until an ephemeral runner shuts down
+	Role               string   // RoleBuild (default) or RoleCache
+	FromFile           bool     // Defined in n3x:runnersFile rather than built in
+}
+
+// Runner roles. A cache node serves the shared Harmonia binary cache and
+// apt-cacher-ng proxy for the build runners; it gets the ZFS cache volume but
+// no Yocto or ccache volumes.
+const (
+	RoleBuild = ""
+	RoleCache = "cache"
+)
+
+// RunnerOutputs holds the Pulumi outputs from creating a runner.
+type RunnerOutputs struct {
+	Spec RunnerSpec // The spec the runner was created from
+
+	InstanceId pulumi.IDOutput
+	PublicIp   pulumi.StringOutput
+	PublicDns  pulumi.StringOutput
+	PrivateIp  pulumi.StringOutput
+	PrivateDns pulumi.StringOutput
+
+	SecurityGroupIds pulumi.StringArrayOutput // As attached, incl. additionalSecurityGroupIds
+	RootVolumeId     pulumi.StringOutput
+
+	DashboardUrl pulumi.StringOutput // Set when n3x:createDashboard is enabled
+
+	TerminateAfter pulumi.StringOutput // Set for ephemeral runners (RFC 3339)
+
+	LaunchTemplateId      pulumi.IDOutput // Set when n3x:emitLaunchTemplate is enabled
+	LaunchTemplateVersion pulumi.IntOutput
+}
+
+// Program is the n3x stack: it resolves the n3x: config, creates the
+// network, access and shared resources, launches the runners through
+// CreateRunner and exports the stack outputs. main runs it via pulumi.Run.
+func Program(ctx *pulumi.Context) error {
+	cfg := config.New(ctx, "n3x")
+
+	// --- Configuration ---
+
+	// Sizing profile (dev/staging/prod) supplies defaults for the keys below;
+	// each key still overrides its profile value. See profiles.go.
+	profile, err := lookupProfile(cfg.Get("profile"))
+	if err != nil {
+		return err
+	}
+
+	rootVolumeSize := cfg.GetInt("rootVolumeSize")
+	if rootVolumeSize == 0 {
+		rootVolumeSize = profile.rootVolumeSize
+	}
+	cacheVolumeSize := cfg.GetInt("cacheVolumeSize")
+	if cacheVolumeSize == 0 {
+		cacheVolumeSize = profile.cacheVolumeSize
+	}
+	yoctoVolumeSize := cfg.GetInt("yoctoVolumeSize")
+	if yoctoVolumeSize == 0 {
+		yoctoVolumeSize = profile.yoctoVolumeSize
+	}
+	// Default EBS type for every volume without its own type setting
+	// (gp2 can be marginally cheaper for tiny dev stacks).
+	volumeType := cfg.Get("volumeType")
+	if volumeType == "" {
+		volumeType = "gp3"
+	}
+	if volumeType != "gp3" && volumeType != "gp2" {
+		// Other types need per-volume settings (io1/io2 IOPS) or cannot
+		// hold every volume (HDDs cannot boot and start at 125 GiB)
+		return configErrorf("volumeType", "use gp3 or gp2", "%q is not a general-purpose SSD type", volumeType)
+	}
+
+	// Root volume options beyond size. throughput applies to gp3 only;
+	// setting rootVolumeKmsKeyId implies encryption.
+	rootVolume := VolumeSettings{
+		VolumeType: cfg.Get("rootVolumeType"),
+		Iops:       cfg.GetInt("rootVolumeIops"),
+		Throughput: cfg.GetInt("rootVolumeThroughput"),
+		Encrypted:  cfg.GetBool("rootVolumeEncrypted"),
+		KmsKeyId:   cfg.Get("rootVolumeKmsKeyId"),
+	}
+	if rootVolume.VolumeType == "" {
+		rootVolume.VolumeType = volumeType
+	}
+
+	// Separate KMS keys for the root (OS) and data volumes, e.g. for data
+	// classification rules. When only one of the two is set it encrypts
+	// every volume; rootVolumeKmsKeyId keeps encrypting the root only.
+	rootKmsKeyId := cfg.Get("rootKmsKeyId")
+	dataKmsKeyId := cfg.Get("dataKmsKeyId")
+	if rootKmsKeyId != "" && rootVolume.KmsKeyId != "" {
+		return configErrorf("rootKmsKeyId", "unset n3x:rootVolumeKmsKeyId", "mutually exclusive with n3x:rootVolumeKmsKeyId")
+	}
+	if rootKmsKeyId == "" && rootVolume.KmsKeyId == "" {
+		rootKmsKeyId = dataKmsKeyId
+	}
+	if dataKmsKeyId == "" {
+		dataKmsKeyId = rootKmsKeyId
+	}
+	if rootKmsKeyId != "" {
+		rootVolume.KmsKeyId = rootKmsKeyId
+	}
+	if rootVolume.KmsKeyId != "" {
+		if v, err := cfg.TryBool("rootVolumeEncrypted"); err == nil && !v {
+			return configErrorf("rootVolumeKmsKeyId", "unset n3x:rootVolumeEncrypted or set it to true", "requires encryption")
+		}
+		rootVolume.Encrypted = true
+	}
+	if rootVolume.VolumeType == "st1" || rootVolume.VolumeType == "sc1" {
+		return configErrorf("rootVolumeType", "use gp3, gp2, io1, io2 or standard", "%s: HDD volumes cannot be boot volumes", rootVolume.VolumeType)
+	}
+	if err := rootVolume.validate(); err != nil {
+		return configErrorf("rootVolume*", "", "%w", err)
+	}
+
+	// Cache, Yocto and ccache volumes: n3x:volumeType at its baseline (gp3:
+	// 3000 IOPS, 125 MiB/s) — sufficient for the Nix store and Yocto caches.
+	dataVolume := VolumeSettings{VolumeType: volumeType, Encrypted: dataKmsKeyId != "", KmsKeyId: dataKmsKeyId}
+
+	// Yocto volume options: its large sequential downloads suit a cheaper
+	// throughput-optimized HDD (st1/sc1), which takes no IOPS or
+	// throughput setting and has a 125 GiB minimum.
+	yoctoVolume := VolumeSettings{
+		VolumeType: cfg.Get("yoctoVolumeType"),
+		Iops:       cfg.GetInt("yoctoVolumeIops"),
+		Throughput: cfg.GetInt("yoctoVolumeThroughput"),
+		Encrypted:  dataVolume.Encrypted,
+		KmsKeyId:   dataVolume.KmsKeyId,
+	}
+	if yoctoVolume.VolumeType == "" {
+		yoctoVolume.VolumeType = volumeType
+	}
+	if err := yoctoVolume.validate(); err != nil {
+		return configErrorf("yoctoVolume*", "", "%w", err)
+	}
+
+	instanceTypeX86 := cfg.Get("instanceTypeX86")
+	if instanceTypeX86 == "" {
+		instanceTypeX86 = profile.instanceTypeX86
+	}
+	instanceTypeGraviton := cfg.Get("instanceTypeGraviton")
+	if instanceTypeGraviton == "" {
+		instanceTypeGraviton = profile.instanceTypeGraviton
+	}
+
+	// Optional: ordered instance-type fallback lists. The first entry is
+	// launched; the rest are validated and exported so an operator can
+	// switch to the next type when the primary hits a capacity error.
+	instanceTypesX86, err := resolveInstanceTypes(cfg, "instanceTypesX86", "instanceTypeX86", instanceTypeX86)
+	if err != nil {
+		return err
+	}
+	instanceTypesGraviton, err := resolveInstanceTypes(cfg, "instanceTypesGraviton", "instanceTypeGraviton", instanceTypeGraviton)
+	if err != nil {
+		return err
+	}
+
+	detailedMonitoring := profile.detailedMonitoring
+	if v, err := cfg.TryBool("detailedMonitoring"); err == nil {
+		detailedMonitoring = v
+	}
+	createAlarms := profile.alarms
+	if v, err := cfg.TryBool("createAlarms"); err == nil {
+		createAlarms = v
+	}
+
+	// Optional: one composite alarm over the status check and stalled-I/O
+	// alarms, in ALARM when any runner is unhealthy, notifying
+	// alarmTopicArn (an existing SNS topic) if set.
+	compositeAlarm := cfg.GetBool("compositeAlarm")
+	alarmTopicArn := cfg.Get("alarmTopicArn")
+	if alarmTopicArn != "" && !strings.HasPrefix(alarmTopicArn, "arn:") {
+		return configErrorf("alarmTopicArn", "", "%q: expected an SNS topic ARN (arn:aws:sns:...)", alarmTopicArn)
+	}
+	if alarmTopicArn != "" && !compositeAlarm {
+		return configErrorf("alarmTopicArn", "set n3x:compositeAlarm", "requires n3x:compositeAlarm")
+	}
+
+	// Optional: CPU credit mode for burstable (t-family) runners; unlimited
+	// avoids throttling once credits run out during long builds. Ignored
+	// for fixed-performance instance types.
+	cpuCreditSpecification := cfg.Get("cpuCreditSpecification")
+	if cpuCreditSpecification != "" && cpuCreditSpecification != "standard" && cpuCreditSpecification != "unlimited" {
+		return configErrorf("cpuCreditSpecification", "use standard or unlimited", "unknown value %q", cpuCreditSpecification)
+	}
+
+	// Optional: Nitro Enclaves on the build runners (e.g. for handling
+	// signing material). Every build runner type is validated for support.
+	enclaveEnabled := cfg.GetBool("enclaveEnabled")
+
+	// Network-only mode: create just the security group and key pair (e.g.
+	// for network review ahead of compute approval). No AMI is required.
+	networkOnly := cfg.GetBool("networkOnly")
+
+	// Volumes-only mode: create the runners' data volumes (and security
+	// groups) but no instances or attachments, e.g. to seed caches ahead
+	// of compute approval. The next full deploy attaches the same volumes.
+	volumesOnly := cfg.GetBool("volumesOnly")
+	if volumesOnly && networkOnly {
+		return configErrorf("volumesOnly", "unset n3x:volumesOnly or n3x:networkOnly", "mutually exclusive with n3x:networkOnly")
+	}
+
+	// GitLab runner tags for the built-in runners, applied as the GitLabTags
+	// instance tag and exported for `gitlab-runner register --tag-list`.
+	gitlabTagsX86 := []string{"nix", "isar", "x86_64"}
+	if err := cfg.GetObject("gitlabTagsX86", &gitlabTagsX86); err != nil {
+		return configErrorf("gitlabTagsX86", "", "%w", err)
+	}
+	gitlabTagsGraviton := []string{"nix", "isar", "aarch64"}
+	if err := cfg.GetObject("gitlabTagsGraviton", &gitlabTagsGraviton); err != nil {
+		return configErrorf("gitlabTagsGraviton", "", "%w", err)
+	}
+
+	// Optional: per-runner bootstrap (e.g. mirror URLs, pool names),
+	// shell lines appended to the built-in runners' user-data script.
+	userDataX86 := cfg.Get("userDataX86")
+	userDataGraviton := cfg.Get("userDataGraviton")
+
+	// Optional: spot instance types per built-in runner. With any set,
+	// the multi-arch ASG launches spot capacity (capacity-optimized)
+	// diversified over each runner's list.
+	var spotInstanceTypesX86, spotInstanceTypesGraviton []string
+	if err := cfg.GetObject("spotInstanceTypesX86", &spotInstanceTypesX86); err != nil {
+		return configErrorf("spotInstanceTypesX86", "", "%w", err)
+	}
+	if err := cfg.GetObject("spotInstanceTypesGraviton", &spotInstanceTypesGraviton); err != nil {
+		return configErrorf("spotInstanceTypesGraviton", "", "%w", err)
+	}
+
+	// Optional: versioned JSON file of runner definitions (GitOps). When set
+	// it replaces the built-in x86_64/Graviton runners and their config keys
+	// (amiX86, amiArm64, instanceType*, networkInterfaceId*). Relative paths
+	// resolve against the Pulumi project directory.
+	runnersFile := cfg.Get("runnersFile")
+
+	// Built-in runner architectures: "x86", "arm64" or "both". Unset keeps
+	// the original behavior — the x86_64 runner, plus the Graviton runner
+	// when amiArm64 is set.
+	architectures := cfg.Get("architectures")
+	wantX86, wantArm64 := true, false
+	switch architectures {
+	case "":
+	case "x86":
+	case "arm64":
+		wantX86, wantArm64 = false, true
+	case "both":
+		wantArm64 = true
+	default:
+		return configErrorf("architectures", "use x86, arm64 or both", "unknown value %q", architectures)
+	}
+
+	// Custom NixOS AMI IDs (built via system.build.images.amazon, registered
+	// via register-ami.sh), by architecture: n3x:amisByArch
+	// ({"x86_64": ..., "arm64": ...}), else the legacy amiX86/amiArm64.
+	var amisByArch map[string]string
+	if err := cfg.GetObject("amisByArch", &amisByArch); err != nil {
+		return configErrorf("amisByArch", "", "%w", err)
+	}
+	for arch := range amisByArch {
+		if arch != "x86_64" && arch != "arm64" {
+			return configErrorf("amisByArch", "use the keys x86_64 and arm64", "unknown architecture %q", arch)
+		}
+	}
+	amiX86 := cfg.Get("amiX86")
+	amiArm64 := cfg.Get("amiArm64")
+	for key, ami := range map[string]*string{"amiX86": &amiX86, "amiArm64": &amiArm64} {
+		arch := "x86_64"
+		if key == "amiArm64" {
+			arch = "arm64"
+		}
+		if mapped := amisByArch[arch]; mapped != "" {
+			if *ami != "" && *ami != mapped {
+				return configErrorf(key, "unset n3x:"+key+" or make it match", "%s conflicts with n3x:amisByArch.%s (%s)", *ami, arch, mapped)
+			}
+			*ami = mapped
+		}
+	}
+	if !networkOnly && runnersFile == "" {
+		if wantX86 && amiX86 == "" {
+			return configErrorf("amiX86", requiredConfigHint("amiX86")+" (or n3x:amisByArch.x86_64)", "required configuration value is not set")
+		}
+		if wantArm64 && amiArm64 == "" {
+			return configErrorf("amiArm64", "pulumi config set n3x:amiArm64 ami-... (or n3x:amisByArch.arm64)", "required configuration value is not set")
+		}
+		if architectures == "" && amiArm64 != "" {
+			wantArm64 = true
+		}
+	}
+
+	// Pin running instances to their current AMI: a newly published AMI ID
+	// no longer replaces a runner mid-build until pinAmi is unset.
+	pinAmi := cfg.GetBool("pinAmi")
+
+	// Management access: "ssh" (default) opens the SSH port and exports SSH
+	// commands; "ssm" opens no SSH port and exports SSM Session Manager
+	// commands instead (requires the SSM agent and an instance role).
+	sshAccess := cfg.Get("sshAccess")
+	if sshAccess == "" {
+		sshAccess = "ssh"
+	}
+	if sshAccess != "ssh" && sshAccess != "ssm" {
+		return configErrorf("sshAccess", "use ssh or ssm", "unknown mode %q", sshAccess)
+	}
+
+	// SSM-only fleets can skip the EC2 key pair (createKeyPair=false): the
+	// instances launch without a key and are reached through Session
+	// Manager only, which needs an instance profile with the SSM policy.
+	createKeyPair := true
+	if v, err := cfg.TryBool("createKeyPair"); err == nil {
+		createKeyPair = v
+	}
+
+	// SSH public key for remote management (required with a key pair).
+	// Set via: pulumi config set n3x:sshPublicKey "ssh-ed25519 AAAA..."
+	var sshPublicKey string
+	if createKeyPair {
+		sshPublicKey, err = requireConfig(cfg, "sshPublicKey", requiredConfigHint("sshPublicKey"))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Optional: keep root's authorized_keys in sync with sshPublicKey
+	// through an SSM association, so a rotated key reaches the running
+	// instances in place. The key pair keeps the key it was created with
+	// and only seeds the first boot of new instances.
+	manageSshKeysViaSsm := cfg.GetBool("manageSshKeysViaSsm")
+	var keyFingerprint string
+	if manageSshKeysViaSsm {
+		if sshPublicKey == "" {
+			sshPublicKey, err = requireConfig(cfg, "sshPublicKey", requiredConfigHint("sshPublicKey"))
+			if err != nil {
+				return err
+			}
+		}
+		if strings.ContainsAny(sshPublicKey, "'\r\n") {
+			return configErrorf("sshPublicKey", "use a single authorized_keys line", "must not contain quotes or line breaks with n3x:manageSshKeysViaSsm")
+		}
+		if keyFingerprint, err = sshKeyFingerprint(sshPublicKey); err != nil {
+			return configErrorf("sshPublicKey", "", "%w", err)
+		}
+	}
+
+	// Optional: restrict SSH access to specific CIDR blocks.
+	// Default: 0.0.0.0/0 (open — restrict in production).
+	sshCidrBlocks := cfg.Get("sshCidrBlocks")
+	if sshCidrBlocks == "" {
+		sshCidrBlocks = "0.0.0.0/0"
+	}
+
+	// Optional: sshd port of the AMI (hardened images move it off 22 to
+	// cut scanner noise). Drives the SSH rules and the exported commands.
+	sshPort := 22
+	if v := cfg.GetInt("sshPort"); v != 0 {
+		sshPort = v
+	}
+	if sshPort < 1 || sshPort > 65535 {
+		return configErrorf("sshPort", "use 1-65535", "invalid port %d", sshPort)
+	}
+
+	// Optional: EC2 Instance Connect Endpoint — SSH to the runners' private
+	// IPs through AWS (IAM-authorized), without a bastion or public SSH port.
+	// The endpoint's security group may reach the SSH port in the runner
+	// subnets, and the runner/cache security groups admit SSH from it.
+	instanceConnectEndpoint := cfg.GetBool("instanceConnectEndpoint")
+
+	// Optional: ad-hoc ingress rules (debug services, custom caches)
+	var extraIngressConfig []ruleConfig
+	if err := cfg.GetObject("extraIngressRules", &extraIngressConfig); err != nil {
+		return configErrorf("extraIngressRules", "", "%w", err)
+	}
+	var extraIngress []sgRule
+	for i, rc := range extraIngressConfig {
+		rule, err := rc.toRule()
+		if err != nil {
+			return configErrorf(fmt.Sprintf("extraIngressRules[%d]", i), "", "%w", err)
+		}
+		extraIngress = append(extraIngress, rule)
+	}
+
+	// Optional: launch the runners without a public IP (default: the
+	// subnet's setting). SSH then needs a private route, or the
+	// instance connect endpoint.
+	associatePublicIp := true
+	if v, err := cfg.TryBool("associatePublicIp"); err == nil {
+		associatePublicIp = v
+	}
+
+	// Optional: IAM role and instance profile for the runners with
+	// AmazonSSMManagedInstanceCore (SSM documents, patching, Session
+	// Manager), CloudWatchAgentServerPolicy with cloudwatchAgent, and any
+	// instanceRolePolicyArns.
+	createInstanceProfile := cfg.GetBool("createInstanceProfile")
+
+	if err := validateAccessConfig(accessConfig{
+		sshAccess:               sshAccess,
+		createKeyPair:           createKeyPair,
+		createInstanceProfile:   createInstanceProfile,
+		associatePublicIp:       associatePublicIp,
+		sshCidrBlocks:           sshCidrBlocks,
+		sshPort:                 sshPort,
+		sshPortSet:              cfg.Get("sshPort") != "",
+		instanceConnectEndpoint: instanceConnectEndpoint,
+		extraIngress:            extraIngress,
+	}); err != nil {
+		return err
+	}
+
+	// Attachment device names for the data volumes (normalized to /dev/sd[f-p]).
+	// Nitro instances expose them as NVMe devices in attachment order.
+	cacheDeviceName, err := resolveDeviceName(cfg, "cacheDeviceName", "/dev/sdf")
+	if err != nil {
+		return err
+	}
+	yoctoDeviceName, err := resolveDeviceName(cfg, "yoctoDeviceName", "/dev/sdg")
+	if err != nil {
+		return err
+	}
+	ccacheDeviceName, err := resolveDeviceName(cfg, "ccacheDeviceName", "/dev/sdh")
+	if err != nil {
+		return err
+	}
+
+	// Optional: compiler cache (ccache/sccache) tier, separate from the Nix
+	// store pool. 0 (default) skips the volume. Standalone volumes outlive
+	// instance termination either way; ccacheDeleteOnTermination=false
+	// additionally retains the volume when Pulumi deletes or replaces it.
+	ccacheVolumeSize := cfg.GetInt("ccacheVolumeSize")
+	ccacheDeleteOnTermination := true
+	if v, err := cfg.TryBool("ccacheDeleteOnTermination"); err == nil {
+		ccacheDeleteOnTermination = v
+	}
+
+	// Keep root volumes after instance termination (e.g. for forensics on
+	// a suspicious build). They are then left `available` and must be
+	// deleted by hand.
+	deleteRootOnTermination := true
+	if v, err := cfg.TryBool("deleteRootOnTermination"); err == nil {
+		deleteRootOnTermination = v
+	}
+
+	// Optional: drop the Yocto volume for Nix-only runners.
+	enableYoctoVolume := true
+	if v, err := cfg.TryBool("enableYoctoVolume"); err == nil {
+		enableYoctoVolume = v
+	}
+	if enableYoctoVolume {
+		if err := yoctoVolume.validateSize(yoctoVolumeSize); err != nil {
+			return configErrorf("yoctoVolumeSize", "raise n3x:yoctoVolumeSize or change n3x:yoctoVolumeType", "%w", err)
+		}
+	}
+
+	devices := map[string]string{cacheDeviceName: "cacheDeviceName"}
+	for key, dev := range map[string]string{"yoctoDeviceName": yoctoDeviceName, "ccacheDeviceName": ccacheDeviceName} {
+		if key == "ccacheDeviceName" && ccacheVolumeSize == 0 {
+			continue
+		}
+		if key == "yoctoDeviceName" && !enableYoctoVolume {
+			continue
+		}
+		if other, ok := devices[dev]; ok {
+			return configErrorf(key, "pick a different device letter", "resolves to %s, already used by n3x:%s", dev, other)
+		}
+		devices[dev] = key
+	}
+
+	// Destroy guard: instances and cache volumes are protected unless
+	// allowDestroy is true. Destroying is a two-step flow — set the flag and
+	// `pulumi up` to lift protection, then `pulumi destroy`.
+	allowDestroy := cfg.GetBool("allowDestroy")
+
+	// Optional: seed cache volumes from an EBS snapshot of a warm Nix store.
+	cacheSnapshotId := cfg.Get("cacheSnapshotId")
+
+	// Optional: Fast Snapshot Restore (FSR) for cacheSnapshotId in the listed
+	// AZs. Volumes created from an FSR-enabled snapshot are fully initialized,
+	// avoiding lazy-load latency on first reads. Billed per snapshot per AZ-hour.
+	fastSnapshotRestore := cfg.GetBool("fastSnapshotRestore")
+	var fastSnapshotRestoreAzs []string
+	if err := cfg.GetObject("fastSnapshotRestoreAzs", &fastSnapshotRestoreAzs); err != nil {
+		return configErrorf("fastSnapshotRestoreAzs", "", "%w", err)
+	}
+	if fastSnapshotRestore {
+		if cacheSnapshotId == "" {
+			return configErrorf("fastSnapshotRestore", "set n3x:cacheSnapshotId", "requires n3x:cacheSnapshotId")
+		}
+		if len(fastSnapshotRestoreAzs) == 0 {
+			return configErrorf("fastSnapshotRestore", `e.g. ["us-east-1a"]`, "requires n3x:fastSnapshotRestoreAzs")
+		}
+	}
+
+	// --- Fast Snapshot Restore ---
+
+	fsrStates := pulumi.StringMap{}
+	var fsrResources []pulumi.Resource
+	if fastSnapshotRestore && !networkOnly {
+		for _, az := range fastSnapshotRestoreAzs {
+			fsr, err := ebs.NewFastSnapshotRestore(ctx, fmt.Sprintf("n3x-cache-fsr-%s", az), &ebs.FastSnapshotRestoreArgs{
+				AvailabilityZone: pulumi.String(az),
+				SnapshotId:       pulumi.String(cacheSnapshotId),
+			})
+			if err != nil {
+				return fmt.Errorf("fast snapshot restore %s: %w", az, err)
+			}
+			fsrStates[az] = fsr.State
+			fsrResources = append(fsrResources, fsr)
+		}
+	}
+
+	// Optional: attach an existing ENI (fixed private IP, externally managed
+	// security groups) as each runner's primary interface instead of
+	// creating one. An ENI can only be attached to a single instance.
+	networkInterfaceIdX86 := cfg.Get("networkInterfaceId")
+	networkInterfaceIdGraviton := cfg.Get("networkInterfaceIdGraviton")
+	for key, id := range map[string]string{
+		"networkInterfaceId":         networkInterfaceIdX86,
+		"networkInterfaceIdGraviton": networkInterfaceIdGraviton,
+	} {
+		if id != "" && !strings.HasPrefix(id, "eni-") {
+			return configErrorf(key, "", "%q: expected an ENI ID (eni-...)", id)
+		}
+	}
+
+	// Optional: launch runners into a specific subnet, or spread them
+	// across the AZs of a tagged subnet group ("Key=Value"), instead of
+	// the default VPC's default subnet. The subnets' VPC hosts the security
+	// groups. Required for fixed private IPs (privateIp, privateIpGraviton),
+	// which must fall inside the runner's subnet.
+	subnetId := cfg.Get("subnetId")
+	subnetGroupTag := cfg.Get("subnetGroupTag")
+	privateIpX86 := cfg.Get("privateIp")
+	privateIpGraviton := cfg.Get("privateIpGraviton")
+	var subnets []*ec2.LookupSubnetResult
+	switch {
+	case subnetId != "" && subnetGroupTag != "":
+		return configErrorf("subnetGroupTag", "unset n3x:subnetId or n3x:subnetGroupTag", "mutually exclusive with n3x:subnetId")
+	case subnetId != "":
+		subnet, err := ec2.LookupSubnet(ctx, &ec2.LookupSubnetArgs{Id: pulumi.StringRef(subnetId)})
+		if err != nil {
+			return configErrorf("subnetId", "", "%s: %w", subnetId, err)
+		}
+		subnets = append(subnets, subnet)
+	case subnetGroupTag != "":
+		subnets, err = lookupSubnetGroup(ctx, subnetGroupTag)
+		if err != nil {
+			return configErrorf("subnetGroupTag", "", "%w", err)
+		}
+	}
+
+	// Optional: AWS Outposts placement. The runners launch into the
+	// Outpost's subnets (subnetId / subnetGroupTag must all be on it) and
+	// their data volumes are created on the Outpost.
+	outpostArn := cfg.Get("outpostArn")
+	var volumeOutpostArn pulumi.StringPtrInput
+	if outpostArn != "" {
+		if !strings.HasPrefix(outpostArn, "arn:") || !strings.Contains(outpostArn, ":outpost/") {
+			return configErrorf("outpostArn", "", "%q: expected an Outpost ARN (arn:aws:outposts:...:outpost/op-...)", outpostArn)
+		}
+		if len(subnets) == 0 {
+			return configErrorf("outpostArn", "set n3x:subnetId or n3x:subnetGroupTag to the Outpost's subnets", "requires an explicit subnet")
+		}
+		for _, sn := range subnets {
+			if sn.OutpostArn != outpostArn {
+				return configErrorf("outpostArn", "use subnets created on the Outpost", "subnet %s is not on the Outpost", sn.Id)
+			}
+		}
+		volumeOutpostArn = pulumi.StringPtr(outpostArn)
+	}
+
+	// Optional: the runners' private DNS hostname form, ip-name
+	// (ip-10-0-1-10.<region>.compute.internal) or resource-name
+	// (i-0123456789abcdef0.<region>.compute.internal), and whether the
+	// resource name answers A/AAAA queries. Unset keeps the subnet's
+	// default.
+	privateDnsHostnameType := cfg.Get("privateDnsHostnameType")
+	privateDnsARecord := cfg.GetBool("privateDnsARecord")
+	privateDnsAaaaRecord := cfg.GetBool("privateDnsAaaaRecord")
+	switch privateDnsHostnameType {
+	case "", "ip-name", "resource-name":
+	default:
+		return configErrorf("privateDnsHostnameType", "use ip-name or resource-name", "%q is invalid", privateDnsHostnameType)
+	}
+	if privateDnsHostnameType == "" && (privateDnsARecord || privateDnsAaaaRecord) {
+		return configErrorf("privateDnsHostnameType", "set n3x:privateDnsHostnameType", "required by n3x:privateDnsARecord / n3x:privateDnsAaaaRecord")
+	}
+
+	// Optional: set each runner's OS hostname to its resource name (e.g.
+	// n3x-runner-x86) for log correlation. The name goes on the instance's
+	// Hostname tag, which the user data reads back through the instance
+	// metadata tags at boot, overriding the AMI's networking.hostName.
+	setHostname := cfg.GetBool("setHostname")
+
+	// Optional: launch into reserved capacity — either one capacity
+	// reservation (must match the runners' instance type and AZ) or a
+	// resource group of reservations AWS picks a match from.
+	capacityReservationId := cfg.Get("capacityReservationId")
+	capacityReservationGroupArn := cfg.Get("capacityReservationGroupArn")
+	if capacityReservationId != "" && capacityReservationGroupArn != "" {
+		return configErrorf("capacityReservationGroupArn", "unset n3x:capacityReservationId or n3x:capacityReservationGroupArn", "mutually exclusive with n3x:capacityReservationId")
+	}
+	if capacityReservationGroupArn != "" && !strings.HasPrefix(capacityReservationGroupArn, "arn:") {
+		return configErrorf("capacityReservationGroupArn", "", "%q: expected a resource group ARN (arn:aws:resource-groups:...)", capacityReservationGroupArn)
+	}
+
+	// Optional: launch the build runners into a purchased EC2 Capacity
+	// Block (the capacity-block market; GPU/Trainium types only). The
+	// instances are terminated when the block ends.
+	capacityBlockId := cfg.Get("capacityBlockId")
+	if capacityBlockId != "" {
+		if capacityReservationId != "" || capacityReservationGroupArn != "" {
+			return configErrorf("capacityBlockId", "unset n3x:capacityReservationId / n3x:capacityReservationGroupArn", "mutually exclusive with the other capacity reservation settings")
+		}
+		if !strings.HasPrefix(capacityBlockId, "cr-") {
+			return configErrorf("capacityBlockId", "", "%q: expected a capacity reservation ID (cr-...)", capacityBlockId)
+		}
+	}
+
+	// Optional: alarm when a data volume stalls I/O (VolumeStalledIOCheck),
+	// a failure mode that otherwise silently hangs long builds. The EBS
+	// AutoEnableIO volume attribute is not exposed by the AWS provider.
+	ebsHealthMonitoring := cfg.GetBool("ebsHealthMonitoring")
+	if compositeAlarm && !createAlarms && !ebsHealthMonitoring {
+		return configErrorf("compositeAlarm", "set n3x:createAlarms or n3x:ebsHealthMonitoring", "no alarms to combine")
+	}
+
+	// Optional: nix.conf snippet for consumers of the runners' Harmonia
+	// caches. cachePublicKey is the cache-signing public key
+	// (nix key convert-secret-to-public); cacheUrls defaults to
+	// https://<public DNS> of each runner, or the cache ALB's domain.
+	cachePublicKey := cfg.Get("cachePublicKey")
+	var cacheUrls []string
+	if err := cfg.GetObject("cacheUrls", &cacheUrls); err != nil {
+		return configErrorf("cacheUrls", "", "%w", err)
+	}
+
+	// Optional: the GitLab runner token and the cache-signing secret key
+	// held in existing SSM parameters (SecureString), which stay the single
+	// source of truth instead of Pulumi config. Nothing in the stack consumes
+	// the token, so its parameter is only checked to exist (no decryption).
+	// The signing key is decrypted and held as a Pulumi secret; only its
+	// public half, which provides cachePublicKey when that is unset, is
+	// derived from it.
+	gitlabTokenParam := cfg.Get("gitlabTokenParam")
+	signingKeyParam := cfg.Get("signingKeyParam")
+	var gitlabToken, signingKey *ssm.LookupParameterResult
+	if gitlabTokenParam != "" {
+		gitlabToken, err = ssm.LookupParameter(ctx, &ssm.LookupParameterArgs{Name: gitlabTokenParam})
+		if err != nil {
+			return configErrorf("gitlabTokenParam", "use the name or ARN of an existing parameter", "%s: %w", gitlabTokenParam, err)
+		}
+	}
+	cacheKey := pulumi.String(cachePublicKey).ToStringOutput()
+	if signingKeyParam != "" {
+		signingKey, err = ssm.LookupParameter(ctx, &ssm.LookupParameterArgs{Name: signingKeyParam, WithDecryption: pulumi.BoolRef(true)})
+		if err != nil {
+			return configErrorf("signingKeyParam", "use the name or ARN of an existing parameter", "%s: %w", signingKeyParam, err)
+		}
+		secretKey := pulumi.ToSecret(pulumi.String(signingKey.Value)).(pulumi.StringOutput)
+		publicKey := secretKey.ApplyT(func(key string) (string, error) {
+			publicKey, err := nixPublicKey(key)
+			if err != nil {
+				return "", configErrorf("signingKeyParam", "store the output of nix key generate-secret", "%s: %w", signingKeyParam, err)
+			}
+			if cachePublicKey != "" && cachePublicKey != publicKey {
+				return "", configErrorf("cachePublicKey", "unset n3x:cachePublicKey to use the signing key's", "does not match the key in %s (%s)", signingKeyParam, publicKey)
+			}
+			return publicKey, nil
+		}).(pulumi.StringOutput)
+		// The public half is not secret; nixConfigSnippet exports it in the clear
+		cacheKey = pulumi.Unsecret(publicKey).(pulumi.StringOutput)
+	}
+
+	// Optional: ALB in front of the Harmonia caches for a public binary
+	// cache. TLS terminates on an ACM certificate for cacheAlbDomain,
+	// DNS-validated in the Route53 zone cacheAlbZoneId (which also gets
+	// the domain's alias record), and is forwarded to cacheAlbBackendPort.
+	createCacheAlb := cfg.GetBool("createCacheAlb")
+	cacheAlbDomain := cfg.Get("cacheAlbDomain")
+	cacheAlbZoneId := cfg.Get("cacheAlbZoneId")
+	cacheAlbBackendPort := cfg.GetInt("cacheAlbBackendPort")
+	if cacheAlbBackendPort == 0 {
+		cacheAlbBackendPort = 443 // Caddy in front of Harmonia
+	}
+	if createCacheAlb {
+		if cacheAlbDomain == "" {
+			return configErrorf("cacheAlbDomain", "e.g. cache.example.com", "required by n3x:createCacheAlb")
+		}
+		if cacheAlbZoneId == "" {
+			return configErrorf("cacheAlbZoneId", "the Route53 hosted zone ID of cacheAlbDomain", "required by n3x:createCacheAlb")
+		}
+		if cacheAlbBackendPort < 1 || cacheAlbBackendPort > 65535 {
+			return configErrorf("cacheAlbBackendPort", "", "%d: expected a port (1-65535)", cacheAlbBackendPort)
+		}
+		albAzs := map[string]bool{}
+		for _, sn := range subnets {
+			albAzs[sn.AvailabilityZone] = true
+		}
+		if len(albAzs) < 2 {
+			return configErrorf("createCacheAlb", "set n3x:subnetGroupTag to subnets in two or more AZs", "an ALB needs subnets in at least two AZs")
+		}
+	}
+
+	// Optional: dedicated shared cache node. Instead of every runner serving
+	// its own Harmonia/apt-cacher-ng caches, one node (x86_64, amiX86) holds
+	// the large ZFS volume and the runners are pointed at its private DNS.
+	cacheNode := cfg.GetBool("cacheNode")
+	cacheNodeInstanceType := cfg.Get("cacheNodeInstanceType")
+	if cacheNodeInstanceType == "" {
+		cacheNodeInstanceType = "m6i.large"
+	}
+	cacheNodeVolumeSize := cfg.GetInt("cacheNodeVolumeSize")
+	if cacheNodeVolumeSize == 0 {
+		cacheNodeVolumeSize = cacheVolumeSize
+	}
+	if cacheNode && !networkOnly {
+		if amiX86 == "" {
+			return configErrorf("cacheNode", "set n3x:amiX86", "requires n3x:amiX86")
+		}
+		if err := requireArchitecture(cacheNodeInstanceType, "x86_64"); err != nil {
+			return configErrorf("cacheNodeInstanceType", "", "%w", err)
+		}
+	}
+
+	// Optional: one io2 Multi-Attach cache volume shared by all build runners
+	// instead of a cache volume each. The runners are launched in the first
+	// runner's AZ. ZFS is not a cluster filesystem: only one runner may
+	// import the pool read-write; the others must import it read-only.
+	cacheMultiAttach := cfg.GetBool("cacheMultiAttach")
+	sharedCacheVolume := VolumeSettings{
+		VolumeType: "io2",
+		Iops:       cfg.GetInt("cacheMultiAttachIops"),
+		Encrypted:  dataVolume.Encrypted,
+		KmsKeyId:   dataVolume.KmsKeyId,
+	}
+	if sharedCacheVolume.Iops == 0 {
+		sharedCacheVolume.Iops = 3000
+	}
+	if cacheMultiAttach {
+		if cacheNode {
+			return configErrorf("cacheMultiAttach", "unset n3x:cacheNode or n3x:cacheMultiAttach", "mutually exclusive with n3x:cacheNode")
+		}
+		if err := sharedCacheVolume.validate(); err != nil {
+			return configErrorf("cacheMultiAttachIops", "", "%w", err)
+		}
+		// io2 volumes are at most 64 TiB
+		if cacheVolumeSize > 65536 {
+			return configErrorf("cacheMultiAttach", "lower n3x:cacheVolumeSize", "cacheVolumeSize %d GB exceeds the io2 maximum (65536)", cacheVolumeSize)
+		}
+	}
+
+	// Optional: cost guardrail — the instance types runners may use. Entries
+	// are exact types or globs ("c6i.*"); empty allows any type.
+	var allowedInstanceTypes []string
+	if err := cfg.GetObject("allowedInstanceTypes", &allowedInstanceTypes); err != nil {
+		return configErrorf("allowedInstanceTypes", "", "%w", err)
+	}
+	for _, pattern := range allowedInstanceTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return configErrorf("allowedInstanceTypes", "", "%q: %w", pattern, err)
+		}
+	}
+
+	// Optional: extra volumes created once and attached to every runner
+	// (cache node included), e.g. a read-only tools volume. With more than
+	// one runner they must be Multi-Attach (io1/io2) and all runners are
+	// launched in the first runner's AZ.
+	var sharedVolumes []SharedVolumeConfig
+	if err := cfg.GetObject("sharedVolumes", &sharedVolumes); err != nil {
+		return configErrorf("sharedVolumes", "", "%w", err)
+	}
+	sharedVolumeNames := map[string]bool{}
+	for i := range sharedVolumes {
+		sv := &sharedVolumes[i]
+		key := fmt.Sprintf("sharedVolumes[%d]", i)
+		if err := sv.validate(); err != nil {
+			return configErrorf(key, "", "%w", err)
+		}
+		if sharedVolumeNames[sv.Name] {
+			return configErrorf(key, "", "duplicate name %q", sv.Name)
+		}
+		sharedVolumeNames[sv.Name] = true
+		if other, ok := devices[sv.DeviceName]; ok {
+			return configErrorf(key, "pick a different device letter", "%q: %s is already used by n3x:%s", sv.Name, sv.DeviceName, other)
+		}
+		devices[sv.DeviceName] = key
+	}
+
+	// Shared volumes are sized and placed around the instances
+	if volumesOnly && cacheMultiAttach {
+		return configErrorf("volumesOnly", "", "not supported with n3x:cacheMultiAttach")
+	}
+	if volumesOnly && len(sharedVolumes) > 0 {
+		return configErrorf("volumesOnly", "", "not supported with n3x:sharedVolumes")
+	}
+
+	// Optional: cap on the total EBS GB the stack provisions, checked before
+	// any resources are created (accounts in smaller regions hit the
+	// per-region EBS storage quota mid-deploy otherwise). 0 disables it.
+	maxTotalEbsGb := cfg.GetInt("maxTotalEbsGb")
+
+	// How to treat volumes provisioned beyond the instance type's baseline
+	// EBS bandwidth: warn (default), error or off.
+	ebsBandwidthCheck := cfg.Get("ebsBandwidthCheck")
+	if ebsBandwidthCheck == "" {
+		ebsBandwidthCheck = "warn"
+	}
+	if ebsBandwidthCheck != "warn" && ebsBandwidthCheck != "error" && ebsBandwidthCheck != "off" {
+		return configErrorf("ebsBandwidthCheck", "use warn, error or off", "unknown mode %q", ebsBandwidthCheck)
+	}
+
+	// vCPUs per concurrent job for the suggested GitLab runner concurrency
+	// (runnerConcurrency output). Default 2: an 8-vCPU runner suggests 4.
+	concurrencyVcpuDivisor := cfg.GetInt("concurrencyVcpuDivisor")
+	if concurrencyVcpuDivisor == 0 {
+		concurrencyVcpuDivisor = 2
+	}
+	if concurrencyVcpuDivisor < 0 {
+		return configErrorf("concurrencyVcpuDivisor", "", "must be positive (got %d)", concurrencyVcpuDivisor)
+	}
+
+	// Optional: SSM Command document that re-imports the ZFS pool and
+	// remounts /nix, run on demand against the runners from the console or
+	// `aws ssm send-command`. Requires the SSM agent and an instance role
+	// with AmazonSSMManagedInstanceCore on the runners.
+	createSsmDocuments := cfg.GetBool("createSsmDocuments")
+
+	// Optional: CloudWatch agent configuration for the data volumes' mount
+	// points, published as an SSM parameter the runners load on boot.
+	// Requires the agent in the AMI and an instance role with
+	// CloudWatchAgentServerPolicy.
+	cloudwatchAgent := cfg.GetBool("cloudwatchAgent")
+
+	var instanceRolePolicyArns []string
+	if err := cfg.GetObject("instanceRolePolicyArns", &instanceRolePolicyArns); err != nil {
+		return configErrorf("instanceRolePolicyArns", "", "%w", err)
+	}
+	for i, arn := range instanceRolePolicyArns {
+		if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":policy/") {
+			return configErrorf(fmt.Sprintf("instanceRolePolicyArns[%d]", i), "", "%q: expected an IAM policy ARN (arn:aws:iam::...:policy/...)", arn)
+		}
+		if slices.Contains(instanceRolePolicyArns[:i], arn) {
+			return configErrorf(fmt.Sprintf("instanceRolePolicyArns[%d]", i), "remove the duplicate", "%s is listed twice", arn)
+		}
+	}
+	if len(instanceRolePolicyArns) > 0 && !createInstanceProfile {
+		return configErrorf("instanceRolePolicyArns", "set n3x:createInstanceProfile", "requires the stack's instance role")
+	}
+
+	// Optional: SQS queue of pending build jobs for demand-driven scaling,
+	// readable by the runner role. With multiArchAsg a target-tracking
+	// policy scales the group to keep the queue's visible messages near
+	// jobQueueTargetMessages (default 10).
+	createJobQueue := cfg.GetBool("createJobQueue")
+	jobQueueTargetMessages := 10
+	if v, err := cfg.TryInt("jobQueueTargetMessages"); err == nil {
+		jobQueueTargetMessages = v
+	}
+	if createJobQueue {
+		if !createInstanceProfile {
+			return configErrorf("createJobQueue", "set n3x:createInstanceProfile", "grants queue access to the stack's instance role")
+		}
+		if jobQueueTargetMessages < 1 {
+			return configErrorf("jobQueueTargetMessages", "", "%d: must be at least 1", jobQueueTargetMessages)
+		}
+	}
+
+	// Optional: AWS Resource Group over this stack's Project/Stack tags,
+	// listing the runners, volumes and security groups together.
+	createResourceGroup := cfg.GetBool("createResourceGroup")
+
+	// Optional: per-runner CloudWatch dashboard (CPU, network, EBS).
+	createDashboard := cfg.GetBool("createDashboard")
+
+	// Optional: disaster-recovery copy of the cacheSnapshotId warm-store
+	// snapshot in a second region (via a provider for that region).
+	drRegion := cfg.Get("drRegion")
+
+	var region string
+	// Customer-managed root and data volume keys must be usable here; the
+	// account default EBS key always is.
+	checkKmsKey := rootVolume.KmsKeyId != "" && rootVolume.KmsKeyId != defaultEbsKeyAlias
+	checkDataKmsKey := dataKmsKeyId != "" && dataKmsKeyId != defaultEbsKeyAlias && dataKmsKeyId != rootVolume.KmsKeyId
+	if createDashboard || drRegion != "" || checkKmsKey || checkDataKmsKey {
+		r, err := aws.GetRegion(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("region lookup: %w", err)
+		}
+		region = r.Name
+	}
+	if checkKmsKey {
+		key := "rootVolumeKmsKeyId"
+		if cfg.Get(key) == "" {
+			key = "rootKmsKeyId"
+			if cfg.Get(key) == "" {
+				key = "dataKmsKeyId"
+			}
+		}
+		if err := checkEbsKmsKey(ctx, rootVolume.KmsKeyId, region); err != nil {
+			return configErrorf(key, "use an enabled key in the deployment region, or unset it for the account default", "%w", err)
+		}
+	}
+	if checkDataKmsKey {
+		if err := checkEbsKmsKey(ctx, dataKmsKeyId, region); err != nil {
+			return configErrorf("dataKmsKeyId", "use an enabled key in the deployment region, or unset it for the account default", "%w", err)
+		}
+	}
+	if drRegion != "" {
+		if cacheSnapshotId == "" {
+			return configErrorf("drRegion", "set n3x:cacheSnapshotId", "requires n3x:cacheSnapshotId (the snapshot to copy)")
+		}
+		if drRegion == region {
+			return configErrorf("drRegion", "pick a region other than "+region, "%s is the stack's own region", drRegion)
+		}
+	}
+
+	// Optional: pinned known-good ("golden") cache snapshot to roll back
+	// to after a bad Nix store upgrade. It is only a reference — cache
+	// volumes keep their cacheSnapshotId seed until the rollback flow
+	// (see cacheRollbackCommand) points cacheSnapshotId at it.
+	goldenCacheSnapshotId := cfg.Get("goldenCacheSnapshotId")
+	if goldenCacheSnapshotId != "" {
+		golden, err := ebs.LookupSnapshot(ctx, &ebs.LookupSnapshotArgs{
+			SnapshotIds: []string{goldenCacheSnapshotId},
+		})
+		if err != nil {
+			return configErrorf("goldenCacheSnapshotId", "", "%s: %w", goldenCacheSnapshotId, err)
+		}
+		if golden.State != "completed" {
+			return configErrorf("goldenCacheSnapshotId", "wait for the snapshot to complete", "%s is %s", goldenCacheSnapshotId, golden.State)
+		}
+		restoreSize := cacheVolumeSize
+		if cacheNode {
+			restoreSize = min(cacheVolumeSize, cacheNodeVolumeSize)
+		}
+		if golden.VolumeSize > restoreSize {
+			return configErrorf("goldenCacheSnapshotId", "raise n3x:cacheVolumeSize / n3x:cacheNodeVolumeSize", "%s is %d GB, larger than the %d GB cache volume", goldenCacheSnapshotId, golden.VolumeSize, restoreSize)
+		}
+	}
+
+	// Optional: SSM Maintenance Window (schedule expression, e.g.
+	// "cron(0 3 ? * SUN *)") that patches the stack's instances, found by
+	// their Project/Stack tags. NixOS runners default to a shell command;
+	// patchDocument AWS-RunPatchBaseline uses the stock patch baseline.
+	patchWindow := cfg.Get("patchWindow")
+	patchDocument := cfg.Get("patchDocument")
+	if patchDocument == "" {
+		patchDocument = "AWS-RunShellScript"
+	}
+	patchCommand := cfg.Get("patchCommand")
+	if patchCommand == "" {
+		patchCommand = "nixos-rebuild switch --upgrade"
+	}
+	if patchWindow != "" && !strings.HasPrefix(patchWindow, "cron(") && !strings.HasPrefix(patchWindow, "rate(") {
+		return configErrorf("patchWindow", `e.g. "cron(0 3 ? * SUN *)"`, "%q: expected a cron(...) or rate(...) expression", patchWindow)
+	}
+	if patchDocument != "AWS-RunShellScript" && patchDocument != "AWS-RunPatchBaseline" {
+		return configErrorf("patchDocument", "use AWS-RunShellScript or AWS-RunPatchBaseline", "unsupported document %q", patchDocument)
+	}
+
+	// Optional: schedule name for an existing AWS Instance Scheduler
+	// deployment, applied as its Schedule tag on the instances (the
+	// scheduler then stops and starts them). Omitted by default.
+	instanceScheduleTag := cfg.Get("instanceScheduleTag")
+	if len(instanceScheduleTag) > 256 {
+		return configErrorf("instanceScheduleTag", "", "%d characters exceeds the 256-character tag value limit", len(instanceScheduleTag))
+	}
+
+	// Optional: capture each runner as a standalone launch template (AMI,
+	// type, security group, block devices, user data) for launching ad-hoc
+	// (e.g. spot) instances by hand. Nothing is launched from it.
+	emitLaunchTemplate := cfg.GetBool("emitLaunchTemplate")
+
+	// Optional: one Auto Scaling group spanning the build runners' launch
+	// templates (x86_64 and Graviton alike) through a mixed instances
+	// policy, as an elastic multi-arch pool next to the fixed runners.
+	multiArchAsg := cfg.GetBool("multiArchAsg")
+	asgMinSize := cfg.GetInt("asgMinSize")
+	asgMaxSize := cfg.GetInt("asgMaxSize")
+	if asgMaxSize == 0 {
+		asgMaxSize = 4
+	}
+	asgDesiredCapacity := asgMinSize
+	if v, err := cfg.TryInt("asgDesiredCapacity"); err == nil {
+		asgDesiredCapacity = v
+	}
+	// On-demand base and the on-demand share above it; the rest is spot.
+	// The share defaults to 0 with spot instance types, else 100.
+	asgOnDemandBaseCapacity := cfg.GetInt("asgOnDemandBaseCapacity")
+	asgOnDemandPercentage := -1 // unset
+	if v, err := cfg.TryInt("asgOnDemandPercentage"); err == nil {
+		asgOnDemandPercentage = v
+		if v < 0 || v > 100 {
+			return configErrorf("asgOnDemandPercentage", "", "%d: expected a percentage (0-100)", v)
+		}
+	}
+	// Seconds the group waits after a launch before acting on failed
+	// health checks (AWS's default is 300), and the minimum number of
+	// stopped, pre-initialized instances kept in a warm pool (0: none).
+	healthCheckGracePeriod := 300
+	if v, err := cfg.TryInt("healthCheckGracePeriod"); err == nil {
+		healthCheckGracePeriod = v
+	}
+	if healthCheckGracePeriod < 0 {
+		return configErrorf("healthCheckGracePeriod", "", "%d: expected seconds (0 or more)", healthCheckGracePeriod)
+	}
+	warmPoolSize := cfg.GetInt("warmPoolSize")
+	if warmPoolSize < 0 {
+		return configErrorf("warmPoolSize", "", "%d: expected an instance count (0 or more)", warmPoolSize)
+	}
+	if warmPoolSize > 0 && !multiArchAsg {
+		return configErrorf("warmPoolSize", "set n3x:multiArchAsg", "sizes the multi-arch ASG's warm pool")
+	}
+	if asgOnDemandBaseCapacity < 0 || asgOnDemandBaseCapacity > asgMaxSize {
+		return configErrorf("asgOnDemandBaseCapacity", "", "need 0 <= asgOnDemandBaseCapacity (%d) <= asgMaxSize (%d)", asgOnDemandBaseCapacity, asgMaxSize)
+	}
+	if multiArchAsg {
+		if !emitLaunchTemplate {
+			return configErrorf("multiArchAsg", "set n3x:emitLaunchTemplate", "requires the runners' launch templates")
+		}
+		if volumesOnly {
+			return configErrorf("multiArchAsg", "unset n3x:volumesOnly", "needs runners to take launch templates from")
+		}
+		if asgMinSize < 0 || asgMinSize > asgMaxSize || asgDesiredCapacity < asgMinSize || asgDesiredCapacity > asgMaxSize {
+			return configErrorf("asgDesiredCapacity", "", "need 0 <= asgMinSize (%d) <= asgDesiredCapacity (%d) <= asgMaxSize (%d)", asgMinSize, asgDesiredCapacity, asgMaxSize)
+		}
+	}
+
+	// Optional: root device name (e.g. /dev/sda1) for AMIs that record
+	// none; the launch template's root mapping must name the AMI's root
+	// device. Normally detected from the AMI, which it must then match.
+	rootDeviceName := cfg.Get("rootDeviceName")
+	if rootDeviceName != "" && !strings.HasPrefix(rootDeviceName, "/dev/") {
+		return configErrorf("rootDeviceName", "e.g. /dev/xvda or /dev/sda1", "%q: expected a /dev/ path", rootDeviceName)
+	}
+
+	// Optional: warn at deploy time when a runner's AMI is older than this
+	// many days (0 disables), as a nudge to rotate images.
+	amiMaxAgeDays := cfg.GetInt("amiMaxAgeDays")
+	if amiMaxAgeDays < 0 {
+		return configErrorf("amiMaxAgeDays", "", "%d: must not be negative", amiMaxAgeDays)
+	}
+
+	// Optional: export runner attributes as Terraform tfvars for teams
+	// consuming these runners from Terraform.
+	emitTfvars := cfg.GetBool("emitTfvars")
+
+	// Prefix for AWS-visible names (Name tags, key pair, alarms) so the fleet
+	// is distinguishable in shared accounts. Pulumi resource names are not
+	// prefixed, keeping URNs stable when the prefix changes.
+	namePrefix := cfg.Get("namePrefix")
+	if namePrefix == "" {
+		namePrefix = "n3x"
+	}
+	if !namePrefixPattern.MatchString(namePrefix) {
+		return configErrorf("namePrefix", "use letters, digits and hyphens (max 32)", "%q is invalid", namePrefix)
+	}
+
+	// Base tags for every resource. Volumes are tagged explicitly rather
+	// than through the instance's VolumeTags, which would fight the tags
+	// of the separately attached data volumes. CI sets deployCommit and
+	// deployPipelineId so live resources trace back to their deploy.
+	tags := newStandardTags(ctx.Stack(), cfg.Get("costCenter"))
+	tags.addDeployMetadata(cfg.Get("deployCommit"), cfg.Get("deployPipelineId"))
+
+	// Optional: snapshot-selection tag (e.g. for a DLM policy's target
+	// tags) applied to the volumes whose purpose is in snapshotVolumes
+	// (default: the ZFS cache volumes). Unset leaves volume tags unchanged.
+	snapshotTagKey := cfg.Get("snapshotTagKey")
+	snapshotTagValue := cfg.Get("snapshotTagValue")
+	snapshotVolumes := []string{"zfs-nix-store"}
+	if err := cfg.GetObject("snapshotVolumes", &snapshotVolumes); err != nil {
+		return configErrorf("snapshotVolumes", "", "%w", err)
+	}
+	snapshotPurposes := map[string]bool{}
+	for _, p := range snapshotVolumes {
+		switch p {
+		case "root", "zfs-nix-store", "yocto-cache", "ccache":
+			snapshotPurposes[p] = true
+		default:
+			return configErrorf("snapshotVolumes", "use root, zfs-nix-store, yocto-cache or ccache", "unknown volume purpose %q", p)
+		}
+	}
+	if snapshotTagKey == "" && snapshotTagValue != "" {
+		return configErrorf("snapshotTagValue", "set n3x:snapshotTagKey", "requires n3x:snapshotTagKey")
+	}
+	if strings.HasPrefix(snapshotTagKey, "aws:") {
+		return configErrorf("snapshotTagKey", "", "%q: the aws: prefix is reserved", snapshotTagKey)
+	}
+
+	// Optional: Retention tag value (e.g. "keep") for persistent volumes —
+	// the ZFS cache volumes, and ccache volumes retained on delete — so
+	// volume reapers skip them.
+	retentionPolicy := cfg.Get("retentionPolicy")
+
+	// Snapshot-selection and retention tagging of the runners' volumes
+	volumePolicy := VolumeTagPolicy{
+		SnapshotTagKey:   snapshotTagKey,
+		SnapshotTagValue: snapshotTagValue,
+		SnapshotPurposes: snapshotPurposes,
+		RetentionPolicy:  retentionPolicy,
+		Persistent: map[string]bool{
+			"zfs-nix-store": true,
+			"ccache":        !ccacheDeleteOnTermination,
+			"root":          !deleteRootOnTermination,
+		},
+	}
+	// Resource tally for the summary output, updated as resources are created.
+	var summary stackSummary
+
+	// Optional: approximate monthly cost of the instances and volumes,
+	// exported with its change since the last deploy (costEstimate).
+	estimateCost := cfg.GetBool("estimateCost")
+
+	// --- SSH Key Pair ---
+
+	var keyPair *ec2.KeyPair
+	var keyName pulumi.StringPtrInput
+	if createKeyPair {
+		// CreatedAt records when the key pair (and so its key) was created
+		// for rotation tracking; it is set once and renewed on replacement
+		ignoreChanges := []string{`tags["CreatedAt"]`}
+		if manageSshKeysViaSsm {
+			// Rotation goes through SSM; replacing the key pair would not
+			// reach running instances
+			ignoreChanges = append(ignoreChanges, "publicKey")
+		}
+		keyPair, err = ec2.NewKeyPair(ctx, "n3x-runner-key", &ec2.KeyPairArgs{
+			KeyName:   pulumi.Sprintf("%s-runner-key", namePrefix),
+			PublicKey: pulumi.String(sshPublicKey),
+			Tags: tags.with(pulumi.StringMap{
+				"Name":      pulumi.Sprintf("%s-runner-key", namePrefix),
+				"CreatedAt": pulumi.String(time.Now().UTC().Format(time.RFC3339)),
+			}),
+		}, pulumi.IgnoreChanges(ignoreChanges))
+		if err != nil {
+			return err
+		}
+		keyName = keyPair.KeyName
+	}
+
+	// --- Security Group ---
+
+	var sgIngress []sgRule
+	if sshAccess == "ssh" {
+		// SSH access (restrict sshCidrBlocks in production)
+		sgIngress = append(sgIngress, sgRule{"tcp", sshPort, sshPort, []string{sshCidrBlocks}, "SSH for management"})
+	}
+	if !cacheNode {
+		sgIngress = append(sgIngress,
+			// HTTPS for Harmonia binary cache (Caddy reverse proxy)
+			sgRule{"tcp", 443, 443, []string{sshCidrBlocks}, "HTTPS for Harmonia/Caddy binary cache"},
+			// apt-cacher-ng proxy (cluster-internal)
+			sgRule{"tcp", 3142, 3142, []string{sshCidrBlocks}, "apt-cacher-ng proxy"},
+		)
+	}
+	// Ad-hoc rules from n3x:extraIngressRules
+	sgIngress = append(sgIngress, extraIngress...)
+
+	sgEgress := []sgRule{
+		// All outbound (GitLab, container registries, apt, etc.)
+		{"-1", 0, 0, []string{"0.0.0.0/0"}, "All outbound"},
+	}
+	// Optional: per-destination egress rules replacing the catch-all
+	var egressRules []ruleConfig
+	if err := cfg.GetObject("egressRules", &egressRules); err != nil {
+		return configErrorf("egressRules", "", "%w", err)
+	}
+	if len(egressRules) > 0 {
+		sgEgress = nil
+		for i, rc := range egressRules {
+			rule, err := rc.toRule()
+			if err != nil {
+				return configErrorf(fmt.Sprintf("egressRules[%d]", i), "", "%w", err)
+			}
+			sgEgress = append(sgEgress, rule)
+		}
+	}
+
+	// Security groups live in the runners' VPC: the configured subnets', else the default VPC
+	var sgVpcId pulumi.StringPtrInput
+	if len(subnets) > 0 {
+		sgVpcId = pulumi.StringPtr(subnets[0].VpcId)
+	}
+
+	// Optional: existing security groups (e.g. a mandatory org-wide
+	// baseline) attached to every instance next to the created one. They
+	// must exist in the runners' VPC.
+	var additionalSecurityGroupIds []string
+	if err := cfg.GetObject("additionalSecurityGroupIds", &additionalSecurityGroupIds); err != nil {
+		return configErrorf("additionalSecurityGroupIds", "", "%w", err)
+	}
+	if len(additionalSecurityGroupIds) > 0 {
+		vpcId := ""
+		if len(subnets) > 0 {
+			vpcId = subnets[0].VpcId
+		} else {
+			vpc, err := ec2.LookupVpc(ctx, &ec2.LookupVpcArgs{Default: pulumi.BoolRef(true)})
+			if err != nil {
+				return fmt.Errorf("default VPC: %w", err)
+			}
+			vpcId = vpc.Id
+		}
+		for _, id := range additionalSecurityGroupIds {
+			if !strings.HasPrefix(id, "sg-") {
+				return configErrorf("additionalSecurityGroupIds", "", "%q: expected a security group ID (sg-...)", id)
+			}
+			group, err := ec2.LookupSecurityGroup(ctx, &ec2.LookupSecurityGroupArgs{Id: pulumi.StringRef(id)})
+			if err != nil {
+				return configErrorf("additionalSecurityGroupIds", "", "%s: %w", id, err)
+			}
+			if group.VpcId != vpcId {
+				return configErrorf("additionalSecurityGroupIds", "use a security group of the runners' VPC", "%s is in %s, not %s", id, group.VpcId, vpcId)
+			}
+		}
+	}
+
+	runnerIngress := ingressArgs(sgIngress)
+	var eiceSg *ec2.SecurityGroup
+	var eiceSsh *ec2.SecurityGroupIngressArgs
+	if instanceConnectEndpoint {
+		if len(subnets) == 0 {
+			return configErrorf("instanceConnectEndpoint", "set n3x:subnetId or n3x:subnetGroupTag", "requires an explicit subnet")
+		}
+		var subnetCidrs []string
+		for _, s := range subnets {
+			subnetCidrs = append(subnetCidrs, s.CidrBlock)
+		}
+		eiceEgress := []sgRule{{"tcp", sshPort, sshPort, subnetCidrs, "SSH to runners"}}
+		eiceSg, err = ec2.NewSecurityGroup(ctx, "n3x-eice-sg", &ec2.SecurityGroupArgs{
+			Description: pulumi.String("Security group for the n3x EC2 Instance Connect Endpoint"),
+			VpcId:       sgVpcId,
+			Egress:      egressArgs(eiceEgress),
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-eice-sg", namePrefix),
+			}),
+		})
+		if err != nil {
+			return err
+		}
+		summary.sgRules += len(eiceEgress)
+		eiceSsh = &ec2.SecurityGroupIngressArgs{
+			Protocol:       pulumi.String("tcp"),
+			FromPort:       pulumi.Int(sshPort),
+			ToPort:         pulumi.Int(sshPort),
+			SecurityGroups: pulumi.StringArray{eiceSg.ID()},
+			Description:    pulumi.String("SSH via EC2 Instance Connect Endpoint"),
+		}
+		runnerIngress = append(runnerIngress, eiceSsh)
+	}
+
+	// Cache ALB security group: HTTPS from sshCidrBlocks like the runners'
+	// own cache port, out to the backend port in the runner subnets. The
+	// cache node (or else the runners) admit it by group.
+	var albSg *ec2.SecurityGroup
+	var albBackend *ec2.SecurityGroupIngressArgs
+	if createCacheAlb {
+		var subnetCidrs []string
+		for _, s := range subnets {
+			subnetCidrs = append(subnetCidrs, s.CidrBlock)
+		}
+		albIngress := []sgRule{{"tcp", 443, 443, []string{sshCidrBlocks}, "HTTPS for the binary cache"}}
+		albEgress := []sgRule{{"tcp", cacheAlbBackendPort, cacheAlbBackendPort, subnetCidrs, "Harmonia backends"}}
+		albSg, err = ec2.NewSecurityGroup(ctx, "n3x-cache-alb-sg", &ec2.SecurityGroupArgs{
+			Description: pulumi.String("Security group for the n3x binary cache ALB"),
+			VpcId:       sgVpcId,
+			Ingress:     ingressArgs(albIngress),
+			Egress:      egressArgs(albEgress),
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-cache-alb-sg", namePrefix),
+			}),
+		})
+		if err != nil {
+			return err
+		}
+		summary.sgRules += len(albIngress) + len(albEgress)
+		albBackend = &ec2.SecurityGroupIngressArgs{
+			Protocol:       pulumi.String("tcp"),
+			FromPort:       pulumi.Int(cacheAlbBackendPort),
+			ToPort:         pulumi.Int(cacheAlbBackendPort),
+			SecurityGroups: pulumi.StringArray{albSg.ID()},
+			Description:    pulumi.String("Harmonia binary cache from the cache ALB"),
+		}
+		if !cacheNode {
+			runnerIngress = append(runnerIngress, albBackend)
+		}
+	}
+
+	sg, err := ec2.NewSecurityGroup(ctx, "n3x-runner-sg", &ec2.SecurityGroupArgs{
+		Description: pulumi.String("Security group for n3x build runners"),
+		VpcId:       sgVpcId,
+		Ingress:     runnerIngress,
+		Egress:      egressArgs(sgEgress),
+		Tags: tags.with(pulumi.StringMap{
+			"Name": pulumi.Sprintf("%s-runner-sg", namePrefix),
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	summary.sgRules += len(runnerIngress) + len(sgEgress)
+
+	// Cache node security group: SSH as for the runners, the cache ports
+	// only from instances in the runner security group.
+	var cacheSg *ec2.SecurityGroup
+	if cacheNode {
+		cacheIngress := ec2.SecurityGroupIngressArray{
+			&ec2.SecurityGroupIngressArgs{
+				Protocol:       pulumi.String("tcp"),
+				FromPort:       pulumi.Int(443),
+				ToPort:         pulumi.Int(443),
+				SecurityGroups: pulumi.StringArray{sg.ID()},
+				Description:    pulumi.String("HTTPS for Harmonia/Caddy binary cache from runners"),
+			},
+			&ec2.SecurityGroupIngressArgs{
+				Protocol:       pulumi.String("tcp"),
+				FromPort:       pulumi.Int(3142),
+				ToPort:         pulumi.Int(3142),
+				SecurityGroups: pulumi.StringArray{sg.ID()},
+				Description:    pulumi.String("apt-cacher-ng proxy from runners"),
+			},
+		}
+		if sshAccess == "ssh" {
+			cacheIngress = append(cacheIngress, &ec2.SecurityGroupIngressArgs{
+				Protocol:    pulumi.String("tcp"),
+				FromPort:    pulumi.Int(sshPort),
+				ToPort:      pulumi.Int(sshPort),
+				CidrBlocks:  pulumi.StringArray{pulumi.String(sshCidrBlocks)},
+				Description: pulumi.String("SSH for management"),
+			})
+		}
+		if eiceSsh != nil {
+			cacheIngress = append(cacheIngress, eiceSsh)
+		}
+		if albBackend != nil {
+			cacheIngress = append(cacheIngress, albBackend)
+		}
+		cacheSg, err = ec2.NewSecurityGroup(ctx, "n3x-cache-sg", &ec2.SecurityGroupArgs{
+			Description: pulumi.String("Security group for the n3x shared cache node"),
+			VpcId:       sgVpcId,
+			Ingress:     cacheIngress,
+			Egress:      egressArgs(sgEgress),
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-cache-sg", namePrefix),
+			}),
+		})
+		if err != nil {
+			return err
+		}
+		summary.sgRules += len(cacheIngress) + len(sgEgress)
+	}
+
+	// Optional: shared EFS filesystem mounted on every build runner (e.g. a
+	// common download mirror), with a mount target in each runner subnet.
+	// NFS is admitted only from the runner security group.
+	createEfs := cfg.GetBool("createEfs")
+	efsMountPath := cfg.Get("efsMountPath")
+	if efsMountPath == "" {
+		efsMountPath = "/mnt/efs"
+	}
+	var efsFs *efs.FileSystem
+	var efsMountTargets []pulumi.Resource
+	if createEfs {
+		if len(subnets) == 0 {
+			return configErrorf("createEfs", "set n3x:subnetId or n3x:subnetGroupTag", "requires an explicit subnet for the mount targets")
+		}
+		if !efsMountPathPattern.MatchString(efsMountPath) {
+			return configErrorf("efsMountPath", "use an absolute path of letters, digits, /, _, . and -", "%q is invalid", efsMountPath)
+		}
+		efsIngress := ec2.SecurityGroupIngressArray{
+			&ec2.SecurityGroupIngressArgs{
+				Protocol:       pulumi.String("tcp"),
+				FromPort:       pulumi.Int(2049),
+				ToPort:         pulumi.Int(2049),
+				SecurityGroups: pulumi.StringArray{sg.ID()},
+				Description:    pulumi.String("NFS from runners"),
+			},
+		}
+		efsSg, err := ec2.NewSecurityGroup(ctx, "n3x-efs-sg", &ec2.SecurityGroupArgs{
+			Description: pulumi.String("Security group for the n3x shared EFS filesystem"),
+			VpcId:       sgVpcId,
+			Ingress:     efsIngress,
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-efs-sg", namePrefix),
+			}),
+		})
+		if err != nil {
+			return err
+		}
+		summary.sgRules += len(efsIngress)
+
+		efsFs, err = efs.NewFileSystem(ctx, "n3x-efs", &efs.FileSystemArgs{
+			Encrypted: pulumi.Bool(true),
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-efs", namePrefix),
+			}),
+		}, pulumi.Protect(!allowDestroy))
+		if err != nil {
+			return fmt.Errorf("efs filesystem: %w", err)
+		}
+		for _, subnet := range subnets {
+			mt, err := efs.NewMountTarget(ctx, fmt.Sprintf("n3x-efs-%s", subnet.AvailabilityZone), &efs.MountTargetArgs{
+				FileSystemId:   efsFs.ID(),
+				SubnetId:       pulumi.String(subnet.Id),
+				SecurityGroups: pulumi.StringArray{efsSg.ID()},
+			})
+			if err != nil {
+				return fmt.Errorf("efs mount target %s: %w", subnet.AvailabilityZone, err)
+			}
+			efsMountTargets = append(efsMountTargets, mt)
+		}
+	}
+
+	var eice *ec2transitgateway.InstanceConnectEndpoint
+	if instanceConnectEndpoint {
+		eice, err = ec2transitgateway.NewInstanceConnectEndpoint(ctx, "n3x-eice", &ec2transitgateway.InstanceConnectEndpointArgs{
+			SubnetId:         pulumi.String(subnets[0].Id),
+			SecurityGroupIds: pulumi.StringArray{eiceSg.ID()},
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-eice", namePrefix),
+			}),
+		})
+		if err != nil {
+			return fmt.Errorf("instance connect endpoint: %w", err)
+		}
+	}
+
+	// --- DR Snapshot Copy ---
+
+	var drSnapshot *ebs.SnapshotCopy
+	if drRegion != "" {
+		drProvider, err := aws.NewProvider(ctx, "n3x-dr", &aws.ProviderArgs{
+			Region: pulumi.String(drRegion),
+		})
+		if err != nil {
+			return fmt.Errorf("dr provider: %w", err)
+		}
+		drSnapshot, err = ebs.NewSnapshotCopy(ctx, "n3x-cache-snapshot-dr", &ebs.SnapshotCopyArgs{
+			SourceRegion:     pulumi.String(region),
+			SourceSnapshotId: pulumi.String(cacheSnapshotId),
+			Description:      pulumi.Sprintf("%s cache snapshot %s (DR copy from %s)", namePrefix, cacheSnapshotId, region),
+			Tags: tags.with(pulumi.StringMap{
+				"Name":    pulumi.Sprintf("%s-cache-dr", namePrefix),
+				"Purpose": pulumi.String("zfs-nix-store"),
+			}),
+		}, pulumi.Provider(drProvider))
+		if err != nil {
+			return fmt.Errorf("dr snapshot copy: %w", err)
+		}
+	}
+
+	// --- SSM Documents ---
+
+	var zfsRepairDoc *ssm.Document
+	if createSsmDocuments {
+		content, err := zfsRepairDocument()
+		if err != nil {
+			return fmt.Errorf("zfs repair document: %w", err)
+		}
+		zfsRepairDoc, err = ssm.NewDocument(ctx, "n3x-zfs-repair", &ssm.DocumentArgs{
+			Name:           pulumi.Sprintf("%s-zfs-repair", namePrefix),
+			DocumentType:   pulumi.String("Command"),
+			DocumentFormat: pulumi.String("JSON"),
+			TargetType:     pulumi.String("/AWS::EC2::Instance"),
+			Content:        pulumi.String(content),
+			Tags:           tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("zfs repair document: %w", err)
+		}
+	}
+
+	// --- Instance Profile ---
+
+	// One role shared by every runner; policies are attached by ARN
+	// (AWS-managed ones in the stack's partition).
+	var instanceRole *iam.Role
+	var instanceProfile *iam.InstanceProfile
+	var instancePolicyArns []string
+	if createInstanceProfile {
+		partition, err := aws.GetPartition(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("partition lookup: %w", err)
+		}
+		managed := []string{"AmazonSSMManagedInstanceCore"}
+		if cloudwatchAgent {
+			managed = append(managed, "CloudWatchAgentServerPolicy")
+		}
+		for _, name := range managed {
+			instancePolicyArns = append(instancePolicyArns, fmt.Sprintf("arn:%s:iam::aws:policy/%s", partition.Partition, name))
+		}
+		for _, arn := range instanceRolePolicyArns {
+			if slices.Contains(instancePolicyArns, arn) {
+				return configErrorf("instanceRolePolicyArns", "remove it", "%s is already attached by the stack", arn)
+			}
+		}
+		instancePolicyArns = append(instancePolicyArns, instanceRolePolicyArns...)
+
+		instanceRole, err = iam.NewRole(ctx, "n3x-runner-role", &iam.RoleArgs{
+			Name:             pulumi.Sprintf("%s-runner", namePrefix),
+			Description:      pulumi.String("Instance role for the n3x runners"),
+			AssumeRolePolicy: pulumi.String(ec2AssumeRolePolicy),
+			Tags:             tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("instance role: %w", err)
+		}
+		policyNames := map[string]int{}
+		for _, arn := range instancePolicyArns {
+			policyNames[policyName(arn)]++
+		}
+		for _, arn := range instancePolicyArns {
+			var opts []pulumi.ResourceOption
+			if name := policyName(arn); policyNames[name] == 1 {
+				// Attachments used to be named by policy name alone; keep
+				// them rather than detaching and re-attaching the policy
+				opts = append(opts, pulumi.Aliases([]pulumi.Alias{{Name: pulumi.String("n3x-runner-role-" + name)}}))
+			}
+			if _, err := iam.NewRolePolicyAttachment(ctx, policyAttachmentName(arn), &iam.RolePolicyAttachmentArgs{
+				Role:      instanceRole.Name,
+				PolicyArn: pulumi.String(arn),
+			}, opts...); err != nil {
+				return fmt.Errorf("instance role policy %s: %w", arn, err)
+			}
+		}
+		instanceProfile, err = iam.NewInstanceProfile(ctx, "n3x-runner-profile", &iam.InstanceProfileArgs{
+			Name: pulumi.Sprintf("%s-runner", namePrefix),
+			Role: instanceRole.Name,
+			Tags: tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("instance profile: %w", err)
+		}
+	}
+
+	// --- Build Job Queue ---
+
+	// Pending jobs are published here by the scheduler; the queue depth
+	// drives the multi-arch ASG (see its scaling policy below).
+	var jobQueue *sqs.Queue
+	if createJobQueue {
+		jobQueue, err = sqs.NewQueue(ctx, "n3x-job-queue", &sqs.QueueArgs{
+			Name:                 pulumi.Sprintf("%s-jobs", namePrefix),
+			SqsManagedSseEnabled: pulumi.Bool(true),
+			Tags:                 tags.with(pulumi.StringMap{"Name": pulumi.Sprintf("%s-jobs", namePrefix)}),
+		})
+		if err != nil {
+			return fmt.Errorf("job queue: %w", err)
+		}
+		_, err = iam.NewRolePolicy(ctx, "n3x-runner-role-job-queue", &iam.RolePolicyArgs{
+			Name:   pulumi.String("job-queue"),
+			Role:   instanceRole.Name,
+			Policy: pulumi.Sprintf(jobQueueAccessPolicy, jobQueue.Arn),
+		})
+		if err != nil {
+			return fmt.Errorf("job queue role policy: %w", err)
+		}
+	}
+
+	// --- SSH Key Association ---
+
+	// Runs the SSH key document on the stack's instances (found by their
+	// Project/Stack tags) now, whenever the key changes, and on instances
+	// launched later.
+	var sshKeyAssociation *ssm.Association
+	if manageSshKeysViaSsm {
+		content, err := sshKeysDocument()
+		if err != nil {
+			return fmt.Errorf("ssh key document: %w", err)
+		}
+		sshKeysDoc, err := ssm.NewDocument(ctx, "n3x-ssh-keys", &ssm.DocumentArgs{
+			Name:           pulumi.Sprintf("%s-ssh-keys", namePrefix),
+			DocumentType:   pulumi.String("Command"),
+			DocumentFormat: pulumi.String("JSON"),
+			TargetType:     pulumi.String("/AWS::EC2::Instance"),
+			Content:        pulumi.String(content),
+			Tags:           tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("ssh key document: %w", err)
+		}
+		sshKeyAssociation, err = ssm.NewAssociation(ctx, "n3x-ssh-keys", &ssm.AssociationArgs{
+			AssociationName: pulumi.Sprintf("%s-ssh-keys", namePrefix),
+			Name:            sshKeysDoc.Name,
+			Parameters: pulumi.StringMap{
+				"publicKey": pulumi.String(sshPublicKey),
+			},
+			Targets: ssm.AssociationTargetArray{
+				&ssm.AssociationTargetArgs{
+					Key:    pulumi.String("tag:Project"),
+					Values: pulumi.StringArray{pulumi.String("n3x")},
+				},
+				&ssm.AssociationTargetArgs{
+					Key:    pulumi.String("tag:Stack"),
+					Values: pulumi.StringArray{pulumi.String(ctx.Stack())},
+				},
+			},
+			Tags: tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("ssh key association: %w", err)
+		}
+	}
+
+	// --- Resource Group ---
+
+	var resourceGroup *resourcegroups.Group
+	if createResourceGroup {
+		query, err := resourceGroupQuery(ctx.Stack())
+		if err != nil {
+			return fmt.Errorf("resource group query: %w", err)
+		}
+		resourceGroup, err = resourcegroups.NewGroup(ctx, "n3x-resource-group", &resourcegroups.GroupArgs{
+			Name:        pulumi.Sprintf("%s-%s", namePrefix, ctx.Stack()),
+			Description: pulumi.Sprintf("n3x runner fleet (stack %s)", ctx.Stack()),
+			ResourceQuery: &resourcegroups.GroupResourceQueryArgs{
+				Query: pulumi.String(query),
+			},
+			Tags: tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("resource group: %w", err)
+		}
+	}
+
+	// --- CloudWatch Agent Config ---
+
+	var cwAgentParam *ssm.Parameter
+	var cwAgentConfig string
+	if cloudwatchAgent && !networkOnly {
+		mountPoints := []string{guestMountPoints["root"], guestMountPoints["zfs-nix-store"]}
+		if enableYoctoVolume {
+			mountPoints = append(mountPoints, guestMountPoints["yocto-cache"])
+		}
+		cwAgentConfig, err = cloudwatchAgentConfig(mountPoints)
+		if err != nil {
+			return fmt.Errorf("cloudwatch agent config: %w", err)
+		}
+		// CloudWatchAgentServerPolicy grants read access to AmazonCloudWatch-* only
+		cwAgentParam, err = ssm.NewParameter(ctx, "n3x-cloudwatch-agent-config", &ssm.ParameterArgs{
+			Name:        pulumi.Sprintf("AmazonCloudWatch-%s-runner", namePrefix),
+			Description: pulumi.String("CloudWatch agent configuration for the n3x runners"),
+			Type:        pulumi.String("String"),
+			Value:       pulumi.String(cwAgentConfig),
+			Tags:        tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("cloudwatch agent config: %w", err)
+		}
+	}
+
+	// --- Patch Maintenance Window ---
+
+	var patchMaintenanceWindow *ssm.MaintenanceWindow
+	if patchWindow != "" {
+		patchMaintenanceWindow, err = ssm.NewMaintenanceWindow(ctx, "n3x-patch-window", &ssm.MaintenanceWindowArgs{
+			Name:     pulumi.Sprintf("%s-patch", namePrefix),
+			Schedule: pulumi.String(patchWindow),
+			Duration: pulumi.Int(2), // hours
+			Cutoff:   pulumi.Int(1), // stop starting tasks 1h before the end
+			Tags:     tags.with(nil),
+		})
+		if err != nil {
+			return fmt.Errorf("patch window: %w", err)
+		}
+		target, err := ssm.NewMaintenanceWindowTarget(ctx, "n3x-patch-target", &ssm.MaintenanceWindowTargetArgs{
+			WindowId:     patchMaintenanceWindow.ID(),
+			ResourceType: pulumi.String("INSTANCE"),
+			Targets: ssm.MaintenanceWindowTargetTargetArray{
+				&ssm.MaintenanceWindowTargetTargetArgs{
+					Key:    pulumi.String("tag:Project"),
+					Values: pulumi.StringArray{pulumi.String("n3x")},
+				},
+				&ssm.MaintenanceWindowTargetTargetArgs{
+					Key:    pulumi.String("tag:Stack"),
+					Values: pulumi.StringArray{pulumi.String(ctx.Stack())},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("patch window target: %w", err)
+		}
+		parameters := ssm.MaintenanceWindowTaskTaskInvocationParametersRunCommandParametersParameterArray{
+			&ssm.MaintenanceWindowTaskTaskInvocationParametersRunCommandParametersParameterArgs{
+				Name:   pulumi.String("commands"),
+				Values: pulumi.StringArray{pulumi.String(patchCommand)},
+			},
+		}
+		if patchDocument == "AWS-RunPatchBaseline" {
+			parameters = ssm.MaintenanceWindowTaskTaskInvocationParametersRunCommandParametersParameterArray{
+				&ssm.MaintenanceWindowTaskTaskInvocationParametersRunCommandParametersParameterArgs{
+					Name:   pulumi.String("Operation"),
+					Values: pulumi.StringArray{pulumi.String("Install")},
+				},
+			}
+		}
+		_, err = ssm.NewMaintenanceWindowTask(ctx, "n3x-patch-task", &ssm.MaintenanceWindowTaskArgs{
+			WindowId:       patchMaintenanceWindow.ID(),
+			TaskType:       pulumi.String("RUN_COMMAND"),
+			TaskArn:        pulumi.String(patchDocument),
+			MaxConcurrency: pulumi.String("1"), // one runner at a time keeps capacity up
+			MaxErrors:      pulumi.String("1"),
+			Targets: ssm.MaintenanceWindowTaskTargetArray{
+				&ssm.MaintenanceWindowTaskTargetArgs{
+					Key:    pulumi.String("WindowTargetIds"),
+					Values: pulumi.StringArray{target.ID()},
+				},
+			},
+			TaskInvocationParameters: &ssm.MaintenanceWindowTaskTaskInvocationParametersArgs{
+				RunCommandParameters: &ssm.MaintenanceWindowTaskTaskInvocationParametersRunCommandParametersArgs{
+					Parameters: parameters,
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("patch window task: %w", err)
+		}
+	}
+
+	// --- Runner Config ---
+
+	rc := &Config{
+		NamePrefix:   namePrefix,
+		Region:       region,
+		Tags:         tags,
+		VolumePolicy: volumePolicy,
+
+		RootVolumeSize:            rootVolumeSize,
+		RootVolume:                rootVolume,
+		DeleteRootOnTermination:   deleteRootOnTermination,
+		DataVolume:                dataVolume,
+		CacheVolumeSize:           cacheVolumeSize,
+		CacheNodeVolumeSize:       cacheNodeVolumeSize,
+		CacheSnapshotId:           cacheSnapshotId,
+		CacheMultiAttach:          cacheMultiAttach,
+		SharedCacheVolume:         sharedCacheVolume,
+		EnableYoctoVolume:         enableYoctoVolume,
+		YoctoVolume:               yoctoVolume,
+		YoctoVolumeSize:           yoctoVolumeSize,
+		CcacheVolumeSize:          ccacheVolumeSize,
+		CcacheDeleteOnTermination: ccacheDeleteOnTermination,
+		SharedVolumes:             sharedVolumes,
+		VolumeOutpostArn:          volumeOutpostArn,
+
+		CacheDeviceName:  cacheDeviceName,
+		YoctoDeviceName:  yoctoDeviceName,
+		CcacheDeviceName: ccacheDeviceName,
+
+		AllowDestroy:                allowDestroy,
+		AssociatePublicIp:           associatePublicIp,
+		AdditionalSecurityGroupIds:  additionalSecurityGroupIds,
+		CapacityReservationId:       capacityReservationId,
+		CapacityReservationGroupArn: capacityReservationGroupArn,
+		CapacityBlockId:             capacityBlockId,
+		CpuCreditSpecification:      cpuCreditSpecification,
+		CreateAlarms:                createAlarms,
+		CreateDashboard:             createDashboard,
+		DetailedMonitoring:          detailedMonitoring,
+		EbsHealthMonitoring:         ebsHealthMonitoring,
+		EfsMountPath:                efsMountPath,
+		EmitLaunchTemplate:          emitLaunchTemplate,
+		EnclaveEnabled:              enclaveEnabled,
+		InstanceScheduleTag:         instanceScheduleTag,
+		PinAmi:                      pinAmi,
+		PrivateDnsHostnameType:      privateDnsHostnameType,
+		PrivateDnsARecord:           privateDnsARecord,
+		PrivateDnsAaaaRecord:        privateDnsAaaaRecord,
+		SetHostname:                 setHostname,
+
+		SecurityGroup:        sg,
+		CacheSecurityGroup:   cacheSg,
+		KeyName:              keyName,
+		InstanceProfile:      instanceProfile,
+		CloudWatchAgentParam: cwAgentParam,
+		EfsFileSystem:        efsFs,
+		EfsMountTargets:      efsMountTargets,
+		FastSnapshotRestores: fsrResources,
+
+		summary: &summary,
+	}
+
+	// --- Runners ---
+	// Built-in runners per n3x:architectures (by default x86_64, plus
+	// Graviton when amiArm64 is set), or the list from runnersFile. None in
+	// network-only mode. The cache node, if enabled, comes first so the
+	// build runners can reference it.
+
+	var specs []RunnerSpec
+	switch {
+	case networkOnly:
+	case runnersFile != "":
+		specs, err = loadRunnersFile(runnersFile)
+		if err != nil {
+			return configErrorf("runnersFile", "", "%w", err)
+		}
+	default:
+		if wantX86 {
+			specs = append(specs, RunnerSpec{
+				Name:          "x86",
+				InstanceTypes: instanceTypesX86,
+				AmiId:         amiX86,
+
+				NetworkInterfaceId: networkInterfaceIdX86,
+				GitlabTags:         gitlabTagsX86,
+				PrivateIp:          privateIpX86,
+				UserData:           userDataX86,
+				SpotInstanceTypes:  spotInstanceTypesX86,
+			})
+		}
+		if wantArm64 {
+			// An arm64 AMI on an x86 instance type fails only at boot; catch it here
+			if err := requireGravitonType(instanceTypesGraviton[0]); err != nil {
+				return err
+			}
+			specs = append(specs, RunnerSpec{
+				Name:          "graviton",
+				InstanceTypes: instanceTypesGraviton,
+				AmiId:         amiArm64,
+
+				NetworkInterfaceId: networkInterfaceIdGraviton,
+				GitlabTags:         gitlabTagsGraviton,
+				PrivateIp:          privateIpGraviton,
+				UserData:           userDataGraviton,
+				SpotInstanceTypes:  spotInstanceTypesGraviton,
+			})
+		}
+	}
+	if cacheNode && !networkOnly {
+		specs = append([]RunnerSpec{{
+			Name:          "cache",
+			InstanceTypes: []string{cacheNodeInstanceType},
+			AmiId:         amiX86,
+			Role:          RoleCache,
+		}}, specs...)
+	}
+	// runnersFile entries without an ami use the AMI for their declared
+	// architecture, or the one implied by their first instance type.
+	amiForArch := map[string]string{"x86_64": amiX86, "arm64": amiArm64}
+	for i := range specs {
+		spec := &specs[i]
+		if spec.AmiId != "" {
+			continue
+		}
+		arch := spec.Architecture
+		if arch == "" && len(spec.InstanceTypes) > 0 {
+			if arch, err = instanceArchitecture(spec.InstanceTypes[0]); err != nil {
+				return configErrorf(spec.configKey("instanceTypes"), "", "runner %q: %w", spec.Name, err)
+			}
+		}
+		spec.AmiId = amiForArch[arch] // "" is reported by validateRunnerSpecs
+	}
+	// Detect each runner's architecture from its AMI. Runners without
+	// instance types (runnersFile entries may omit them) get the profile's
+	// default for that architecture; explicit types must match it.
+	for i := range specs {
+		spec := &specs[i]
+		if spec.AmiId == "" {
+			continue // reported by validateRunnerSpecs
+		}
+		declared := spec.Architecture
+		var created time.Time
+		spec.Architecture, spec.RootDeviceName, created, err = describeAmi(ctx, spec.AmiId)
+		if err != nil {
+			return fmt.Errorf("runner %q: %w", spec.Name, err)
+		}
+		spec.AmiAgeDays = int(time.Since(created).Hours() / 24)
+		if amiMaxAgeDays > 0 && spec.AmiAgeDays > amiMaxAgeDays {
+			msg := fmt.Sprintf("runner %q: AMI %s is %d days old (n3x:amiMaxAgeDays is %d); consider rotating it",
+				spec.Name, spec.AmiId, spec.AmiAgeDays, amiMaxAgeDays)
+			if err := ctx.Log.Warn(msg, nil); err != nil {
+				return err
+			}
+		}
+		if declared != "" && declared != spec.Architecture {
+			return configErrorf(spec.configKey("architecture"), "fix the architecture or the ami", "runner %q: declared architecture %s, but AMI %s is %s", spec.Name, declared, spec.AmiId, spec.Architecture)
+		}
+		switch {
+		case spec.RootDeviceName == "":
+			spec.RootDeviceName = rootDeviceName
+		case rootDeviceName != "" && rootDeviceName != spec.RootDeviceName:
+			return configErrorf("rootDeviceName", "unset it to use the detected name", "runner %q: AMI %s has root device %s", spec.Name, spec.AmiId, spec.RootDeviceName)
+		}
+		if spec.RootDeviceName == "" && emitLaunchTemplate {
+			return configErrorf("rootDeviceName", "e.g. /dev/xvda", "runner %q: AMI %s records no root device name (needed for the launch template)", spec.Name, spec.AmiId)
+		}
+		if len(spec.InstanceTypes) == 0 {
+			def := instanceTypeX86
+			if spec.Architecture == "arm64" {
+				def = instanceTypeGraviton
+			}
+			spec.InstanceTypes = []string{def}
+		}
+		for _, t := range spec.InstanceTypes {
+			if err := requireArchitecture(t, spec.Architecture); err != nil {
+				return configErrorf(spec.configKey("instanceTypes"), "use a matching instance type or AMI",
+					"runner %q: AMI %s is %s: %w", spec.Name, spec.AmiId, spec.Architecture, err)
+			}
+		}
+		for _, t := range spec.SpotInstanceTypes {
+			if err := requireArchitecture(t, spec.Architecture); err != nil {
+				return configErrorf(spec.configKey("spotInstanceTypes"), "use spot types of the AMI's architecture",
+					"runner %q: spot types: AMI %s is %s: %w", spec.Name, spec.AmiId, spec.Architecture, err)
+			}
+		}
+		if len(spec.SpotInstanceTypes) > 0 && !multiArchAsg {
+			return configErrorf("multiArchAsg", "set n3x:multiArchAsg or drop the spot instance types", "runner %q: spot instance types are only used by the multi-arch ASG", spec.Name)
+		}
+	}
+	if err := validateRunnerSpecs(specs); err != nil {
+		return err
+	}
+	if len(allowedInstanceTypes) > 0 {
+		// Fallback and spot types count too: any of them may be launched
+		for _, spec := range specs {
+			for _, t := range slices.Concat(spec.InstanceTypes, spec.SpotInstanceTypes) {
+				if !instanceTypeAllowed(t, allowedInstanceTypes) {
+					return configErrorf("allowedInstanceTypes", "add the type to the allowlist or pick an allowed one",
+						"runner %q: instance type %s is not allowed (allowed: %s)", spec.Name, t, strings.Join(allowedInstanceTypes, ", "))
+				}
+			}
+		}
+	}
+
+	// Assign launch subnets round-robin across the AZs (in runner order);
+	// Multi-Attach (cacheMultiAttach or sharedVolumes across several
+	// runners) keeps every runner in the first subnet's AZ. Runners on
+	// an existing ENI stay in its subnet. A runner whose cache volume
+	// already exists is pinned to that volume's AZ, so reordering runners
+	// or changing subnets can't strand it on replacement.
+	singleAz := cacheMultiAttach || (len(sharedVolumes) > 0 && len(specs) > 1)
+	defaultAz := ""
+	if volumesOnly && len(subnets) == 0 {
+		azs, err := aws.GetAvailabilityZones(ctx, &aws.GetAvailabilityZonesArgs{State: pulumi.StringRef("available")})
+		if err != nil {
+			return fmt.Errorf("availability zones: %w", err)
+		}
+		if len(azs.Names) == 0 {
+			return fmt.Errorf("no available AZs in the region")
+		}
+		defaultAz = azs.Names[0]
+	}
+	subnetKey := "subnetGroupTag" // Where the subnets came from, for errors
+	if subnetId != "" {
+		subnetKey = "subnetId"
+	}
+	selectedSubnets := pulumi.StringMap{}
+	for i := range specs {
+		spec := &specs[i]
+		cacheAz := ""
+		if !singleAz && spec.NetworkInterfaceId == "" {
+			az, err := existingCacheAz(ctx, fmt.Sprintf("%s-%s-cache", namePrefix, spec.Name))
+			if err != nil {
+				return fmt.Errorf("runner %q: %w", spec.Name, err)
+			}
+			cacheAz = az
+		}
+		if len(subnets) == 0 || spec.NetworkInterfaceId != "" {
+			switch {
+			case spec.PrivateIp != "" && spec.NetworkInterfaceId != "":
+				return configErrorf(spec.configKey("privateIp"), "drop either privateIp or networkInterfaceId",
+					"runner %q: privateIp cannot be combined with networkInterfaceId (the ENI has its own address)", spec.Name)
+			case spec.PrivateIp != "":
+				return configErrorf(spec.configKey("privateIp"), "set n3x:subnetId or n3x:subnetGroupTag", "runner %q: a fixed private IP requires an explicit subnet", spec.Name)
+			}
+			spec.AvailabilityZone = cacheAz
+			spec.VolumeAz = cacheAz
+			if spec.NetworkInterfaceId != "" {
+				eni, err := ec2.LookupNetworkInterface(ctx, &ec2.LookupNetworkInterfaceArgs{Id: pulumi.StringRef(spec.NetworkInterfaceId)})
+				if err != nil {
+					return fmt.Errorf("runner %q: network interface %s: %w", spec.Name, spec.NetworkInterfaceId, err)
+				}
+				spec.VolumeAz = eni.AvailabilityZone
+			}
+			if spec.VolumeAz == "" && volumesOnly {
+				// No subnet to go by: the next full deploy pins the
+				// runner to this AZ via its cache volume
+				spec.VolumeAz = defaultAz
+			}
+			continue
+		}
+		subnet, err := selectSubnet(subnets, i, singleAz, cacheAz, spec.Name, subnetKey)
+		if err != nil {
+			return err
+		}
+		spec.SubnetId = subnet.Id
+		spec.VolumeAz = subnet.AvailabilityZone
+		selectedSubnets[spec.Name] = pulumi.String(subnet.Id)
+		if spec.PrivateIp != "" {
+			if err := checkPrivateIp(spec.PrivateIp, subnet.CidrBlock); err != nil {
+				return configErrorf(spec.configKey("privateIp"), "", "runner %q: %w", spec.Name, err)
+			}
+		}
+	}
+	if fastSnapshotRestore {
+		// FSR only helps cache volumes created in one of its AZs
+		for _, spec := range specs {
+			if spec.VolumeAz != "" && !slices.Contains(fastSnapshotRestoreAzs, spec.VolumeAz) {
+				return configErrorf("fastSnapshotRestoreAzs", "add "+spec.VolumeAz+" to the list",
+					"runner %q: its volumes are in %s, which has no fast snapshot restore", spec.Name, spec.VolumeAz)
+			}
+		}
+	}
+	if len(sharedVolumes) > 0 && len(specs) > 1 {
+		// Attaching one volume to several runners needs Multi-Attach
+		for i, sv := range sharedVolumes {
+			if !multiAttachTypes[sv.settings().VolumeType] {
+				return configErrorf(fmt.Sprintf("sharedVolumes[%d]", i), "use volumeType io1 or io2",
+					"%q: %s volumes can't attach to all %d runners (Multi-Attach requires io1/io2)", sv.Name, sv.settings().VolumeType, len(specs))
+			}
+		}
+		if len(specs) > 16 {
+			return configErrorf("sharedVolumes", "", "Multi-Attach supports at most 16 runners (%d defined)", len(specs))
+		}
+		for _, spec := range specs {
+			if err := requireNitro(ctx, spec.InstanceTypes[0]); err != nil {
+				return configErrorf("sharedVolumes", "", "Multi-Attach requires Nitro instances: runner %q: %w", spec.Name, err)
+			}
+		}
+	}
+	if enclaveEnabled {
+		for _, spec := range specs {
+			if spec.Role != RoleBuild {
+				continue
+			}
+			for _, t := range spec.InstanceTypes {
+				if err := requireEnclaveSupport(ctx, t); err != nil {
+					return configErrorf("enclaveEnabled", "pick a supported instance type or unset n3x:enclaveEnabled", "runner %q: %w", spec.Name, err)
+				}
+			}
+		}
+	}
+	if capacityBlockId != "" {
+		for _, spec := range specs {
+			if spec.Role != RoleBuild {
+				continue
+			}
+			for _, t := range spec.InstanceTypes {
+				if err := requireCapacityBlockSupport(t); err != nil {
+					return configErrorf("capacityBlockId", "use the Capacity Block's instance type", "runner %q: %w", spec.Name, err)
+				}
+			}
+		}
+	}
+	if outpostArn != "" {
+		// Multi-Attach io1/io2 volumes are not available on Outposts
+		if cacheMultiAttach || len(sharedVolumes) > 0 {
+			return configErrorf("outpostArn", "unset n3x:cacheMultiAttach and n3x:sharedVolumes", "Multi-Attach volumes are not supported on Outposts")
+		}
+		offered, err := outposts.GetOutpostInstanceTypes(ctx, &outposts.GetOutpostInstanceTypesArgs{Arn: outpostArn})
+		if err != nil {
+			return fmt.Errorf("outpost instance types: %w", err)
+		}
+		for _, spec := range specs {
+			for _, t := range spec.InstanceTypes {
+				if !slices.Contains(offered.InstanceTypes, t) {
+					return configErrorf("outpostArn", "pick an instance type the Outpost has capacity for", "runner %q: instance type %s is not offered on the Outpost", spec.Name, t)
+				}
+			}
+		}
+	}
+	if cacheMultiAttach {
+		// A Multi-Attach volume attaches to at most 16 instances
+		if len(specs) > 16 {
+			return configErrorf("cacheMultiAttach", "", "supports at most 16 runners (%d defined)", len(specs))
+		}
+		for _, spec := range specs {
+			if err := requireNitro(ctx, spec.InstanceTypes[0]); err != nil {
+				return configErrorf("cacheMultiAttach", "", "requires Nitro instances: runner %q: %w", spec.Name, err)
+			}
+		}
+	}
+
+	if maxTotalEbsGb > 0 {
+		total := 0
+		sharedCounted := false
+		for _, spec := range specs {
+			for _, v := range rc.plannedVolumes(spec) {
+				if cacheMultiAttach && spec.Role == RoleBuild && v.purpose == "zfs-nix-store" {
+					if sharedCounted {
+						continue
+					}
+					sharedCounted = true
+				}
+				total += v.sizeGb
+			}
+		}
+		for _, sv := range sharedVolumes {
+			total += sv.SizeGb
+		}
+		if total > maxTotalEbsGb {
+			return configErrorf("maxTotalEbsGb", "raise the limit or shrink the volumes", "planned EBS total %d GB across %d runners exceeds %d GB", total, len(specs), maxTotalEbsGb)
+		}
+	}
+
+	// Flag volumes whose throughput exceeds the launched instance type's
+	// baseline EBS bandwidth (paid-for throughput the instance can't use).
+	// Types missing from the ebsbandwidth.go table are skipped.
+	if ebsBandwidthCheck != "off" {
+		for _, spec := range specs {
+			bandwidth, ok := ebsBandwidthMBps(spec.InstanceTypes[0])
+			if !ok {
+				continue
+			}
+			for _, v := range rc.plannedVolumes(spec) {
+				_, throughput := v.settings.effectivePerformance(v.sizeGb)
+				if throughput <= bandwidth {
+					continue
+				}
+				msg := fmt.Sprintf("runner %q: %s volume throughput %d MB/s exceeds the %s baseline EBS bandwidth (%d MB/s)",
+					spec.Name, v.purpose, throughput, spec.InstanceTypes[0], bandwidth)
+				if ebsBandwidthCheck == "error" {
+					return configErrorf("ebsBandwidthCheck", "lower the volume throughput or use a larger instance type", "%s", msg)
+				}
+				if err := ctx.Log.Warn(msg, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Check every configured instance type is offered in the region (one
+	// DescribeInstanceTypeOfferings call; skip it for faster previews).
+	if !cfg.GetBool("skipInstanceTypeCheck") && len(specs) > 0 {
+		var types []string
+		for _, spec := range specs {
+			types = append(types, spec.InstanceTypes...)
+			types = append(types, spec.SpotInstanceTypes...)
+		}
+		if err := checkInstanceTypeOfferings(ctx, types); err != nil {
+			return fmt.Errorf("%w (set n3x:skipInstanceTypeCheck to bypass)", err)
+		}
+	}
+
+	rc.RunnerCount = len(specs)
+	var runners []*RunnerOutputs
+	for _, spec := range specs {
+		if volumesOnly {
+			if _, err := rc.createDataVolumes(ctx, spec, pulumi.String(spec.VolumeAz)); err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := CreateRunner(ctx, rc, spec)
+		if err != nil {
+			return err
+		}
+		if spec.Role == RoleCache {
+			rc.CacheHost = r.PrivateDns
+		}
+		runners = append(runners, r)
+	}
+
+	// --- Fleet Health Composite Alarm ---
+
+	var fleetAlarm *cloudwatch.CompositeAlarm
+	if compositeAlarm && len(rc.healthAlarmNames) > 0 {
+		args := &cloudwatch.CompositeAlarmArgs{
+			AlarmName:        pulumi.Sprintf("%s-fleet-health", namePrefix),
+			AlarmDescription: pulumi.Sprintf("%s runner unhealthy (any status check or stalled-I/O alarm)", namePrefix),
+			AlarmRule:        pulumi.String(compositeAlarmRule(rc.healthAlarmNames)),
+			Tags:             tags.with(nil),
+		}
+		if alarmTopicArn != "" {
+			args.AlarmActions = pulumi.StringArray{pulumi.String(alarmTopicArn)}
+			args.OkActions = pulumi.StringArray{pulumi.String(alarmTopicArn)}
+		}
+		// The rule may only name alarms that already exist
+		fleetAlarm, err = cloudwatch.NewCompositeAlarm(ctx, "n3x-fleet-health-alarm", args, pulumi.DependsOn(rc.healthAlarms))
+		if err != nil {
+			return fmt.Errorf("composite alarm: %w", err)
+		}
+	}
+
+	// --- Binary Cache ALB ---
+
+	// The certificate is validated through its Route53 record before the
+	// HTTPS listener uses it. Targets are the cache node, or else every
+	// build runner; Harmonia's /nix-cache-info is the health check.
+	var cacheAlb *lb.LoadBalancer
+	var cacheCert *acm.Certificate
+	if createCacheAlb {
+		cacheCert, err = acm.NewCertificate(ctx, "n3x-cache-cert", &acm.CertificateArgs{
+			DomainName:       pulumi.String(cacheAlbDomain),
+			ValidationMethod: pulumi.String("DNS"),
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-cache", namePrefix),
+			}),
+		})
+		if err != nil {
+			return fmt.Errorf("cache certificate: %w", err)
+		}
+		dvo := cacheCert.DomainValidationOptions.Index(pulumi.Int(0))
+		validationRecord, err := route53.NewRecord(ctx, "n3x-cache-cert-validation", &route53.RecordArgs{
+			ZoneId:         pulumi.String(cacheAlbZoneId),
+			Name:           dvo.ResourceRecordName().Elem(),
+			Type:           dvo.ResourceRecordType().Elem(),
+			Records:        pulumi.StringArray{dvo.ResourceRecordValue().Elem()},
+			Ttl:            pulumi.Int(60),
+			AllowOverwrite: pulumi.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("cache certificate validation record: %w", err)
+		}
+		validation, err := acm.NewCertificateValidation(ctx, "n3x-cache-cert-validation", &acm.CertificateValidationArgs{
+			CertificateArn:        cacheCert.Arn,
+			ValidationRecordFqdns: pulumi.StringArray{validationRecord.Fqdn},
+		})
+		if err != nil {
+			return fmt.Errorf("cache certificate validation: %w", err)
+		}
+
+		var albSubnets pulumi.StringArray
+		for _, sn := range subnets {
+			albSubnets = append(albSubnets, pulumi.String(sn.Id))
+		}
+		cacheAlb, err = lb.NewLoadBalancer(ctx, "n3x-cache-alb", &lb.LoadBalancerArgs{
+			LoadBalancerType: pulumi.String("application"),
+			SecurityGroups:   pulumi.StringArray{albSg.ID()},
+			Subnets:          albSubnets,
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-cache-alb", namePrefix),
+			}),
+		})
+		if err != nil {
+			return fmt.Errorf("cache load balancer: %w", err)
+		}
+		backendProtocol := "HTTP"
+		if cacheAlbBackendPort == 443 {
+			backendProtocol = "HTTPS"
+		}
+		targetGroup, err := lb.NewTargetGroup(ctx, "n3x-cache-tg", &lb.TargetGroupArgs{
+			Port:       pulumi.Int(cacheAlbBackendPort),
+			Protocol:   pulumi.String(backendProtocol),
+			TargetType: pulumi.String("instance"),
+			VpcId:      pulumi.String(subnets[0].VpcId),
+			HealthCheck: &lb.TargetGroupHealthCheckArgs{
+				Path:     pulumi.String("/nix-cache-info"),
+				Protocol: pulumi.String(backendProtocol),
+			},
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-cache-tg", namePrefix),
+			}),
+		})
+		if err != nil {
+			return fmt.Errorf("cache target group: %w", err)
+		}
+		for _, r := range runners {
+			if cacheNode != (r.Spec.Role == RoleCache) {
+				continue
+			}
+			if _, err := lb.NewTargetGroupAttachment(ctx, fmt.Sprintf("n3x-cache-tg-%s", r.Spec.Name), &lb.TargetGroupAttachmentArgs{
+				TargetGroupArn: targetGroup.Arn,
+				TargetId:       r.InstanceId.ToStringOutput(),
+			}); err != nil {
+				return fmt.Errorf("runner %q: cache target: %w", r.Spec.Name, err)
+			}
+		}
+		if _, err := lb.NewListener(ctx, "n3x-cache-https", &lb.ListenerArgs{
+			LoadBalancerArn: cacheAlb.Arn,
+			Port:            pulumi.Int(443),
+			Protocol:        pulumi.String("HTTPS"),
+			CertificateArn:  validation.CertificateArn,
+			DefaultActions: lb.ListenerDefaultActionArray{
+				&lb.ListenerDefaultActionArgs{
+					Type:           pulumi.String("forward"),
+					TargetGroupArn: targetGroup.Arn,
+				},
+			},
+			Tags: tags.with(pulumi.StringMap{
+				"Name": pulumi.Sprintf("%s-cache-https", namePrefix),
+			}),
+		}); err != nil {
+			return fmt.Errorf("cache listener: %w", err)
+		}
+		if _, err := route53.NewRecord(ctx, "n3x-cache-alias", &route53.RecordArgs{
+			ZoneId: pulumi.String(cacheAlbZoneId),
+			Name:   pulumi.String(cacheAlbDomain),
+			Type:   pulumi.String("A"),
+			Aliases: route53.RecordAliasArray{
+				&route53.RecordAliasArgs{
+					Name:                 cacheAlb.DnsName,
+					ZoneId:               cacheAlb.ZoneId,
+					EvaluateTargetHealth: pulumi.Bool(true),
+				},
+			},
+		}); err != nil {
+			return fmt.Errorf("cache alias record: %w", err)
+		}
+	}
+
+	// --- Multi-Arch Auto Scaling Group ---
+
+	// The first build runner's template is the default; every build
+	// runner's instance types become overrides on its own template, in
+	// runner order (the on-demand priority).
+	var asg *autoscaling.Group
+	var asgOnDemand pulumi.Map
+	var jobQueueScaling *autoscaling.Policy
+	asgTemplates := pulumi.Map{}
+	if multiArchAsg {
+		if len(subnets) == 0 {
+			return configErrorf("multiArchAsg", "set n3x:subnetId or n3x:subnetGroupTag", "requires an explicit subnet")
+		}
+		var subnetIds pulumi.StringArray
+		for _, sn := range subnets {
+			subnetIds = append(subnetIds, pulumi.String(sn.Id))
+		}
+		var defaultTemplate *autoscaling.GroupMixedInstancesPolicyLaunchTemplateLaunchTemplateSpecificationArgs
+		var overrides autoscaling.GroupMixedInstancesPolicyLaunchTemplateOverrideArray
+		onDemandPercentage := asgOnDemandPercentage
+		if onDemandPercentage < 0 {
+			onDemandPercentage = 100
+			for _, r := range runners {
+				if r.Spec.Role == RoleBuild && len(r.Spec.SpotInstanceTypes) > 0 {
+					onDemandPercentage = 0
+				}
+			}
+		}
+		spot := onDemandPercentage < 100
+		for _, r := range runners {
+			if r.Spec.Role != RoleBuild {
+				continue
+			}
+			types := r.Spec.InstanceTypes
+			if len(r.Spec.SpotInstanceTypes) > 0 {
+				types = r.Spec.SpotInstanceTypes
+			}
+			if defaultTemplate == nil {
+				defaultTemplate = &autoscaling.GroupMixedInstancesPolicyLaunchTemplateLaunchTemplateSpecificationArgs{
+					LaunchTemplateId: r.LaunchTemplateId.ToStringOutput(),
+					Version:          pulumi.String("$Latest"),
+				}
+			}
+			for _, t := range types {
+				overrides = append(overrides, &autoscaling.GroupMixedInstancesPolicyLaunchTemplateOverrideArgs{
+					InstanceType: pulumi.String(t),
+					LaunchTemplateSpecification: &autoscaling.GroupMixedInstancesPolicyLaunchTemplateOverrideLaunchTemplateSpecificationArgs{
+						LaunchTemplateId: r.LaunchTemplateId.ToStringOutput(),
+						Version:          pulumi.String("$Latest"),
+					},
+				})
+			}
+			asgTemplates[r.Spec.Name] = pulumi.Map{
+				"launchTemplateId": r.LaunchTemplateId,
+				"version":          r.LaunchTemplateVersion,
+				"architecture":     pulumi.String(r.Spec.Architecture),
+				"instanceTypes":    pulumi.ToStringArray(types),
+				"spot":             pulumi.Bool(spot),
+				"gitlabTags":       pulumi.ToStringArray(r.Spec.GitlabTags),
+			}
+		}
+		if defaultTemplate == nil {
+			return configErrorf("multiArchAsg", "", "no build runners to take launch templates from")
+		}
+		if warmPoolSize > 0 {
+			// AWS has no warm pools for spot or mixed instances policies
+			if spot {
+				return configErrorf("warmPoolSize", "drop the spot instance types and n3x:asgOnDemandPercentage, or unset n3x:warmPoolSize",
+					"warm pools don't support spot instances")
+			}
+			if len(overrides) > 1 {
+				return configErrorf("warmPoolSize", "give the group a single build runner with one instance type, or unset n3x:warmPoolSize",
+					"warm pools need a single launch template and instance type (the group has %d)", len(overrides))
+			}
+		}
+		// Instances are tagged by their launch template (GitLabTags per
+		// architecture); the group's own tags are not propagated
+		var asgTags autoscaling.GroupTagArray
+		groupTags := tags.with(pulumi.StringMap{"Name": pulumi.Sprintf("%s-multiarch", namePrefix)})
+		var tagKeys []string
+		for k := range groupTags {
+			tagKeys = append(tagKeys, k)
+		}
+		sort.Strings(tagKeys)
+		for _, k := range tagKeys {
+			asgTags = append(asgTags, &autoscaling.GroupTagArgs{
+				Key:               pulumi.String(k),
+				Value:             groupTags[k],
+				PropagateAtLaunch: pulumi.Bool(false),
+			})
+		}
+		policy := &autoscaling.GroupMixedInstancesPolicyArgs{
+			LaunchTemplate: &autoscaling.GroupMixedInstancesPolicyLaunchTemplateArgs{
+				LaunchTemplateSpecification: defaultTemplate,
+				Overrides:                   overrides,
+			},
+		}
+		if spot || asgOnDemandBaseCapacity > 0 {
+			// Spot is placed in the pools with the most spare capacity
+			policy.InstancesDistribution = &autoscaling.GroupMixedInstancesPolicyInstancesDistributionArgs{
+				OnDemandBaseCapacity:                pulumi.Int(asgOnDemandBaseCapacity),
+				OnDemandPercentageAboveBaseCapacity: pulumi.Int(onDemandPercentage),
+				SpotAllocationStrategy:              pulumi.String("capacity-optimized"),
+			}
+		}
+		asgOnDemand = pulumi.Map{
+			"baseCapacity":                pulumi.Int(asgOnDemandBaseCapacity),
+			"percentageAboveBaseCapacity": pulumi.Int(onDemandPercentage),
+		}
+		groupArgs := &autoscaling.GroupArgs{
+			Name:                   pulumi.Sprintf("%s-multiarch", namePrefix),
+			MinSize:                pulumi.Int(asgMinSize),
+			MaxSize:                pulumi.Int(asgMaxSize),
+			DesiredCapacity:        pulumi.Int(asgDesiredCapacity),
+			HealthCheckGracePeriod: pulumi.Int(healthCheckGracePeriod),
+			VpcZoneIdentifiers:     subnetIds,
+			MixedInstancesPolicy:   policy,
+			Tags:                   asgTags,
+		}
+		if warmPoolSize > 0 {
+			// Launch the one template directly: a warm pool rules out
+			// the mixed instances policy
+			groupArgs.MixedInstancesPolicy = nil
+			groupArgs.LaunchTemplate = &autoscaling.GroupLaunchTemplateArgs{
+				Id:      defaultTemplate.LaunchTemplateId,
+				Version: defaultTemplate.Version,
+			}
+			groupArgs.WarmPool = &autoscaling.GroupWarmPoolArgs{
+				MinSize:   pulumi.Int(warmPoolSize),
+				PoolState: pulumi.String("Stopped"),
+			}
+		}
+		asg, err = autoscaling.NewGroup(ctx, "n3x-multiarch-asg", groupArgs)
+		if err != nil {
+			return fmt.Errorf("multi-arch auto scaling group: %w", err)
+		}
+		if jobQueue != nil {
+			jobQueueScaling, err = autoscaling.NewPolicy(ctx, "n3x-multiarch-job-queue-scaling", &autoscaling.PolicyArgs{
+				Name:                 pulumi.Sprintf("%s-job-queue", namePrefix),
+				AutoscalingGroupName: asg.Name,
+				PolicyType:           pulumi.String("TargetTrackingScaling"),
+				TargetTrackingConfiguration: &autoscaling.PolicyTargetTrackingConfigurationArgs{
+					CustomizedMetricSpecification: &autoscaling.PolicyTargetTrackingConfigurationCustomizedMetricSpecificationArgs{
+						Namespace:  pulumi.String("AWS/SQS"),
+						MetricName: pulumi.String("ApproximateNumberOfMessagesVisible"),
+						Statistic:  pulumi.String("Average"),
+						MetricDimensions: autoscaling.PolicyTargetTrackingConfigurationCustomizedMetricSpecificationMetricDimensionArray{
+							&autoscaling.PolicyTargetTrackingConfigurationCustomizedMetricSpecificationMetricDimensionArgs{
+								Name:  pulumi.String("QueueName"),
+								Value: jobQueue.Name,
+							},
+						},
+					},
+					TargetValue: pulumi.Float64(float64(jobQueueTargetMessages)),
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("job queue scaling policy: %w", err)
+			}
+		}
+	}
+
+	// --- Outputs ---
+
+	ctx.Export("summary", pulumi.String(summary.String()))
+
+	// Cost delta against the estimate this stack exported on its last
+	// deploy, read back through a reference to the stack itself. Missing
+	// on the first deploy (or before estimateCost was enabled), in which
+	// case the delta is the whole estimate.
+	if estimateCost {
+		if len(rc.cost.unpriced) > 0 {
+			if err := ctx.Log.Warn(fmt.Sprintf("estimateCost: no price for %s; left out of costEstimateUsd", strings.Join(rc.cost.unpriced, ", ")), nil); err != nil {
+				return err
+			}
+		}
+		self, err := pulumi.NewStackReference(ctx, "n3x-cost-baseline", &pulumi.StackReferenceArgs{
+			Name: pulumi.String(fmt.Sprintf("%s/%s/%s", ctx.Organization(), ctx.Project(), ctx.Stack())),
+		})
+		if err != nil {
+			return fmt.Errorf("cost baseline stack reference: %w", err)
+		}
+		previous := 0.0
+		if prev, err := self.GetOutputDetails("costEstimateUsd"); err != nil {
+			ctx.Log.Info(fmt.Sprintf("estimateCost: no previous estimate (%v)", err), nil)
+		} else if v, ok := prev.Value.(float64); ok {
+			previous = v
+		}
+		ctx.Export("costEstimateUsd", pulumi.Float64(usd(rc.cost.monthlyUsd)))
+		ctx.Export("costDeltaUsd", pulumi.Float64(usd(rc.cost.monthlyUsd-previous)))
+	}
+
+	// Setup checklist for new stacks: the commands for every required key
+	var requiredCommands pulumi.StringArray
+	for _, r := range requiredConfig {
+		requiredCommands = append(requiredCommands, pulumi.String(r.command))
+	}
+	ctx.Export("requiredConfig", requiredCommands)
+
+	// Resolved on/off state of the optional features, for a one-look
+	// posture summary. Add new feature flags here.
+	ctx.Export("featuresEnabled", pulumi.BoolMap{
+		"networkOnly":             pulumi.Bool(networkOnly),
+		"volumesOnly":             pulumi.Bool(volumesOnly),
+		"destroyProtection":       pulumi.Bool(!allowDestroy),
+		"pinAmi":                  pulumi.Bool(pinAmi),
+		"keyPair":                 pulumi.Bool(createKeyPair),
+		"ssm":                     pulumi.Bool(sshAccess == "ssm"),
+		"instanceConnectEndpoint": pulumi.Bool(instanceConnectEndpoint),
+		"publicIp":                pulumi.Bool(associatePublicIp),
+		"restrictedEgress":        pulumi.Bool(len(egressRules) > 0),
+		"rootVolumeEncryption":    pulumi.Bool(rootVolume.Encrypted || rootVolume.KmsKeyId != ""),
+		"dataVolumeEncryption":    pulumi.Bool(dataVolume.KmsKeyId != ""),
+		"detailedMonitoring":      pulumi.Bool(detailedMonitoring),
+		"alarms":                  pulumi.Bool(createAlarms),
+		"ebsHealthAlarms":         pulumi.Bool(ebsHealthMonitoring),
+		"compositeAlarm":          pulumi.Bool(compositeAlarm),
+		"dashboards":              pulumi.Bool(createDashboard),
+		"ssmDocuments":            pulumi.Bool(createSsmDocuments),
+		"cloudwatchAgent":         pulumi.Bool(cloudwatchAgent),
+		"resourceGroup":           pulumi.Bool(createResourceGroup),
+		"multiArchAsg":            pulumi.Bool(multiArchAsg),
+		"warmPool":                pulumi.Bool(warmPoolSize > 0),
+		"cacheAlb":                pulumi.Bool(createCacheAlb),
+		"instanceProfile":         pulumi.Bool(createInstanceProfile),
+		"jobQueue":                pulumi.Bool(createJobQueue),
+		"sshKeysViaSsm":           pulumi.Bool(manageSshKeysViaSsm),
+		"outpost":                 pulumi.Bool(outpostArn != ""),
+		"hostnames":               pulumi.Bool(setHostname),
+		"patchWindow":             pulumi.Bool(patchWindow != ""),
+		"instanceSchedule":        pulumi.Bool(instanceScheduleTag != ""),
+		"cacheNode":               pulumi.Bool(cacheNode),
+		"cacheMultiAttach":        pulumi.Bool(cacheMultiAttach),
+		"sharedVolumes":           pulumi.Bool(len(sharedVolumes) > 0),
+		"efs":                     pulumi.Bool(createEfs),
+		"yoctoVolume":             pulumi.Bool(enableYoctoVolume),
+		"retainRootVolume":        pulumi.Bool(!deleteRootOnTermination),
+		"ccacheVolume":            pulumi.Bool(ccacheVolumeSize > 0),
+		"cacheSnapshotSeed":       pulumi.Bool(cacheSnapshotId != ""),
+		"fastSnapshotRestore":     pulumi.Bool(fastSnapshotRestore),
+		"drSnapshotCopy":          pulumi.Bool(drRegion != ""),
+		"goldenSnapshot":          pulumi.Bool(goldenCacheSnapshotId != ""),
+		"capacityReservation":     pulumi.Bool(capacityReservationId != "" || capacityReservationGroupArn != ""),
+		"capacityBlock":           pulumi.Bool(capacityBlockId != ""),
+		"enclaves":                pulumi.Bool(enclaveEnabled),
+		"instanceTypeAllowlist":   pulumi.Bool(len(allowedInstanceTypes) > 0),
+		"launchTemplates":         pulumi.Bool(emitLaunchTemplate),
+		"tfvars":                  pulumi.Bool(emitTfvars),
+		"costEstimate":            pulumi.Bool(estimateCost),
+	})
+	ctx.Export("volumes", rc.volumeInventory)
+	ctx.Export("securityGroupId", sg.ID())
+	ctx.Export("securityGroupRules", pulumi.Map{
+		"ingress": rulesOutput(sgIngress),
+		"egress":  rulesOutput(sgEgress),
+	})
+	if keyPair != nil {
+		ctx.Export("keyPairName", keyPair.KeyName)
+		ctx.Export("keyPairCreatedAt", keyPair.Tags.MapIndex(pulumi.String("CreatedAt")))
+		ctx.Export("keyPairFingerprint", keyPair.Fingerprint)
+	} else {
+		ctx.Export("accessGuidance", pulumi.String("No key pair (createKeyPair=false): connect with the <name>SsmSessionCommand outputs; the stack's instance profile grants AmazonSSMManagedInstanceCore."))
+	}
+
+	if len(fsrStates) > 0 {
+		ctx.Export("fastSnapshotRestoreStates", fsrStates)
+	}
+
+	if len(selectedSubnets) > 0 {
+		ctx.Export("selectedSubnets", selectedSubnets)
+	}
+	if rc.sharedCacheVol != nil {
+		ctx.Export("sharedCacheVolumeId", rc.sharedCacheVol.ID())
+		ctx.Export("sharedCacheInstanceIds", rc.sharedCacheInstances)
+	}
+	if len(rc.sharedVols) > 0 {
+		sharedVolumeIds := pulumi.StringMap{}
+		sharedVolumeInstances := pulumi.StringArrayMap{}
+		for i, sv := range sharedVolumes {
+			sharedVolumeIds[sv.Name] = rc.sharedVols[i].ID().ToStringOutput()
+			sharedVolumeInstances[sv.Name] = rc.sharedVolAttachments[sv.Name]
+		}
+		ctx.Export("sharedVolumeIds", sharedVolumeIds)
+		ctx.Export("sharedVolumeAttachments", sharedVolumeInstances)
+	}
+	if goldenCacheSnapshotId != "" {
+		ctx.Export("goldenCacheSnapshotId", pulumi.String(goldenCacheSnapshotId))
+		ctx.Export("cacheRollbackCommand", pulumi.Sprintf(
+			"pulumi up -c n3x:allowDestroy=true -c n3x:cacheSnapshotId=%s", goldenCacheSnapshotId))
+	}
+	if drSnapshot != nil {
+		ctx.Export("drSnapshotId", drSnapshot.ID())
+		ctx.Export("drRegion", pulumi.String(drRegion))
+	}
+	if patchMaintenanceWindow != nil {
+		ctx.Export("patchWindowId", patchMaintenanceWindow.ID())
+	}
+	if instanceScheduleTag != "" {
+		ctx.Export("instanceSchedule", pulumi.String(instanceScheduleTag))
+	}
+	if capacityBlockId != "" {
+		ctx.Export("capacityBlockId", pulumi.String(capacityBlockId))
+	}
+	if fleetAlarm != nil {
+		ctx.Export("compositeAlarmArn", fleetAlarm.Arn)
+	}
+	if zfsRepairDoc != nil {
+		ctx.Export("zfsRepairDocumentName", zfsRepairDoc.Name)
+	}
+	if cacheAlb != nil {
+		ctx.Export("cacheAlbDnsName", cacheAlb.DnsName)
+		ctx.Export("cacheAlbCertificateArn", cacheCert.Arn)
+		ctx.Export("cacheAlbUrl", pulumi.String("https://"+cacheAlbDomain))
+	}
+	if outpostArn != "" {
+		placement := pulumi.Map{}
+		for _, spec := range specs {
+			placement[spec.Name] = pulumi.Map{
+				"subnetId":         pulumi.String(spec.SubnetId),
+				"availabilityZone": pulumi.String(spec.VolumeAz),
+			}
+		}
+		ctx.Export("outpostArn", pulumi.String(outpostArn))
+		ctx.Export("outpostPlacement", placement)
+	}
+	if sshKeyAssociation != nil {
+		ctx.Export("sshKeyFingerprint", pulumi.String(keyFingerprint))
+		ctx.Export("sshKeyAssociationId", sshKeyAssociation.AssociationId)
+	}
+	if instanceProfile != nil {
+		// Inline policies on the role, by name
+		inlinePolicies := []string{}
+		if jobQueue != nil {
+			inlinePolicies = append(inlinePolicies, "job-queue")
+		}
+		permissions := pulumi.Map{}
+		for _, r := range runners {
+			permissions[r.Spec.Name] = pulumi.Map{
+				"roleName":        instanceRole.Name,
+				"instanceProfile": instanceProfile.Name,
+				"policyArns":      pulumi.ToStringArray(instancePolicyArns),
+				"inlinePolicies":  pulumi.ToStringArray(inlinePolicies),
+			}
+		}
+		ctx.Export("instancePermissions", permissions)
+	}
+	if asg != nil {
+		ctx.Export("multiArchAsgName", asg.Name)
+		ctx.Export("multiArchAsgArn", asg.Arn)
+		ctx.Export("multiArchAsgTemplates", asgTemplates)
+		ctx.Export("multiArchAsgOnDemand", asgOnDemand)
+		ctx.Export("multiArchAsgWarmPoolSize", pulumi.Int(warmPoolSize))
+	}
+	if jobQueue != nil {
+		ctx.Export("jobQueueUrl", jobQueue.Url)
+		ctx.Export("jobQueueArn", jobQueue.Arn)
+	}
+	if jobQueueScaling != nil {
+		ctx.Export("jobQueueScalingPolicyArn", jobQueueScaling.Arn)
+	}
+	if resourceGroup != nil {
+		ctx.Export("resourceGroupArn", resourceGroup.Arn)
+	}
+	if cwAgentParam != nil {
+		ctx.Export("cloudwatchAgentConfigParameter", cwAgentParam.Name)
+		ctx.Export("cloudwatchAgentConfig", pulumi.String(cwAgentConfig))
+	}
+	if cacheSg != nil {
+		ctx.Export("cacheSecurityGroupId", cacheSg.ID())
+	}
+	if eice != nil {
+		ctx.Export("instanceConnectEndpointId", eice.ID())
+	}
+	if efsFs != nil {
+		ctx.Export("efsFileSystemId", efsFs.ID())
+		ctx.Export("efsDnsName", efsFs.DnsName)
+		ctx.Export("efsMountPath", pulumi.String(efsMountPath))
+	}
+	if rc.CacheHost != nil {
+		ctx.Export("cacheNodePrivateDns", rc.CacheHost)
+	}
+
+	// Read-only discovery of this stack's unattached volumes (e.g. left
+	// behind by replaced instances or RetainOnDelete) for manual cleanup.
+	// Reflects AWS state before this deploy. A network-only stack owns no
+	// volumes, so it skips the lookup.
+	if !networkOnly {
+		orphans, err := ebs.GetEbsVolumes(ctx, &ebs.GetEbsVolumesArgs{
+			Tags: map[string]string{"Project": "n3x", "Stack": ctx.Stack()},
+			Filters: []ebs.GetEbsVolumesFilter{
+				{Name: "status", Values: []string{"available"}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("orphaned volume lookup: %w", err)
+		}
+		sort.Strings(orphans.Ids)
+		ctx.Export("orphanedVolumeIds", pulumi.ToStringArray(orphans.Ids))
+	}
+
+	ctx.Export("totalProvisionedIops", pulumi.Int(summary.iops))
+	ctx.Export("totalProvisionedThroughput", pulumi.Int(summary.throughput))
+
+	// Resolved instance type per runner (after profile, config and
+	// runnersFile defaults) for audits and cost reconciliation.
+	runnerInstanceTypes := pulumi.StringMap{}
+	for _, r := range runners {
+		runnerInstanceTypes[r.Spec.Name] = pulumi.String(r.Spec.InstanceTypes[0])
+	}
+	ctx.Export("runnerInstanceTypes", runnerInstanceTypes)
+
+	// Headcount of the created runners by architecture, for capacity
+	// reporting: {"x86": 2, "arm64": 1, "total": 3}
+	fleet := map[string]int{"x86": 0, "arm64": 0}
+	for _, r := range runners {
+		if r.Spec.Architecture == "arm64" {
+			fleet["arm64"]++
+		} else {
+			fleet["x86"]++
+		}
+	}
+	ctx.Export("fleetSummary", pulumi.IntMap{
+		"x86":   pulumi.Int(fleet["x86"]),
+		"arm64": pulumi.Int(fleet["arm64"]),
+		"total": pulumi.Int(len(runners)),
+	})
+
+	// Suggested GitLab runner `concurrent` per build runner, from the
+	// launched type's vCPUs. Types missing from the concurrency.go table are
+	// omitted.
+	runnerConcurrency := pulumi.IntMap{}
+	for _, r := range runners {
+		if r.Spec.Role != RoleBuild {
+			continue
+		}
+		if n, ok := suggestedConcurrency(r.Spec.InstanceTypes[0], concurrencyVcpuDivisor); ok {
+			runnerConcurrency[r.Spec.Name] = pulumi.Int(n)
+		}
+	}
+	ctx.Export("runnerConcurrency", runnerConcurrency)
+	ctx.Export("enclaveEnabled", pulumi.Bool(enclaveEnabled))
+
+	// Expected in-guest device path per volume purpose for each runner, so
+	// provisioning scripts don't hardcode the NVMe numbering.
+	deviceMappings := pulumi.Map{}
+	hypervisors := map[string]string{} // One lookup per instance type
+	deviceNames := rc.dataDeviceNames()
+	for _, spec := range specs {
+		hypervisor, ok := hypervisors[spec.InstanceTypes[0]]
+		if !ok {
+			hypervisor, err = instanceHypervisor(ctx, spec.InstanceTypes[0])
+			if err != nil {
+				return fmt.Errorf("runner %q: %w", spec.Name, err)
+			}
+			hypervisors[spec.InstanceTypes[0]] = hypervisor
+		}
+		attachments := map[string]string{}
+		for _, v := range rc.plannedVolumes(spec) {
+			if v.purpose != "root" {
+				attachments[v.purpose] = deviceNames[v.purpose]
+			}
+		}
+		for _, sv := range sharedVolumes {
+			attachments[sv.Name] = sv.DeviceName
+		}
+		paths := guestDevicePaths(hypervisor == "nitro", spec.RootDeviceName, attachments)
+		deviceMappings[spec.Name] = pulumi.ToStringMap(paths)
+	}
+	ctx.Export("deviceMappings", deviceMappings)
+
+	// Sorted plain-text inventory for committing and diffing in PRs
+	ctx.Export("inventory", pulumi.String(formatInventory(specs, rc.plannedVolumes)))
+
+	// Host records in the CMDB's import schema (see cmdb.go). The owner
+	// defaults to the CostCenter tag value.
+	cmdbOwner := cfg.Get("cmdbOwner")
+	if cmdbOwner == "" {
+		cmdbOwner = cfg.Get("costCenter")
+	}
+	cmdbHosts := pulumi.Array{}
+	for _, r := range runners {
+		role := "gitlab-runner"
+		if r.Spec.Role == RoleCache {
+			role = "binary-cache"
+		}
+		cmdbHosts = append(cmdbHosts, cmdbHost(r.PrivateDns, r.PrivateIp, role, cmdbOwner))
+	}
+	ctx.Export("cmdbExport", pulumi.Map{
+		"schemaVersion": pulumi.String(cmdbSchemaVersion),
+		"hosts":         cmdbHosts,
+	})
+
+	// Non-default sshd port flags for the SSH commands
+	sshPortFlag, tunnelPortFlag := "", ""
+	if sshPort != 22 {
+		sshPortFlag = fmt.Sprintf("-p %d ", sshPort)
+		tunnelPortFlag = fmt.Sprintf(" --remote-port %d", sshPort)
+	}
+	for _, r := range runners {
+		ctx.Export(r.Spec.Name+"InstanceId", r.InstanceId)
+		ctx.Export(r.Spec.Name+"PublicIp", r.PublicIp)
+		ctx.Export(r.Spec.Name+"PublicDns", r.PublicDns)
+		if sshAccess == "ssm" {
+			ctx.Export(r.Spec.Name+"SsmSessionCommand", pulumi.Sprintf("aws ssm start-session --target %s", r.InstanceId))
+		} else {
+			ctx.Export(r.Spec.Name+"SshCommand", pulumi.Sprintf("ssh %sroot@%s", sshPortFlag, r.PublicIp))
+		}
+		if instanceConnectEndpoint {
+			ctx.Export(r.Spec.Name+"EiceSshCommand", pulumi.Sprintf(
+				"ssh -o ProxyCommand='aws ec2-instance-connect open-tunnel --instance-id %s%s' root@%s", r.InstanceId, tunnelPortFlag, r.PrivateIp))
+		}
+		if r.Spec.NetworkInterfaceId != "" || r.Spec.PrivateIp != "" {
+			ctx.Export(r.Spec.Name+"PrivateIp", r.PrivateIp)
+		}
+		if privateDnsHostnameType != "" {
+			ctx.Export(r.Spec.Name+"PrivateDns", r.PrivateDns)
+		}
+		ctx.Export(r.Spec.Name+"SecurityGroupIds", r.SecurityGroupIds)
+		if setHostname {
+			ctx.Export(r.Spec.Name+"Hostname", pulumi.String(runnerHostname(namePrefix, r.Spec.Name)))
+		}
+		if r.Spec.Ephemeral {
+			ctx.Export(r.Spec.Name+"TerminateAfter", r.TerminateAfter)
+		}
+		if len(r.Spec.InstanceTypes) > 1 {
+			ctx.Export(r.Spec.Name+"InstanceTypes", pulumi.ToStringArray(r.Spec.InstanceTypes))
+		}
+		if len(r.Spec.SpotInstanceTypes) > 0 {
+			ctx.Export(r.Spec.Name+"SpotInstanceTypes", pulumi.ToStringArray(r.Spec.SpotInstanceTypes))
+		}
+		if len(r.Spec.GitlabTags) > 0 {
+			ctx.Export(r.Spec.Name+"GitlabTags", pulumi.ToStringArray(r.Spec.GitlabTags))
+		}
+		if createDashboard {
+			ctx.Export(r.Spec.Name+"DashboardUrl", r.DashboardUrl)
+		}
+		if emitLaunchTemplate {
+			ctx.Export(r.Spec.Name+"LaunchTemplateId", r.LaunchTemplateId)
+			ctx.Export(r.Spec.Name+"LaunchTemplateVersion", r.LaunchTemplateVersion)
+		}
+		ctx.Export(r.Spec.Name+"Architecture", pulumi.String(r.Spec.Architecture))
+		ctx.Export(r.Spec.Name+"AmiAgeDays", pulumi.Int(r.Spec.AmiAgeDays))
+		ctx.Export(r.Spec.Name+"RootVolumeId", r.RootVolumeId)
+	}
+
+	// Every runner's public IP as one comma-separated value, e.g. for
+	// upstream allowlists; runners without a public IP are skipped
+	if len(runners) > 0 {
+		var publicIps []interface{}
+		for _, r := range runners {
+			publicIps = append(publicIps, r.PublicIp)
+		}
+		ctx.Export("allPublicIps", pulumi.All(publicIps...).ApplyT(func(ips []interface{}) string {
+			var out []string
+			for _, ip := range ips {
+				if s := ip.(string); s != "" {
+					out = append(out, s)
+				}
+			}
+			return strings.Join(out, ",")
+		}).(pulumi.StringOutput))
+	}
+
+	if cachePublicKey != "" || signingKey != nil {
+		substituters := pulumi.StringArray{}
+		for _, u := range cacheUrls {
+			substituters = append(substituters, pulumi.String(u))
+		}
+		if len(cacheUrls) == 0 && createCacheAlb {
+			substituters = append(substituters, pulumi.String("https://"+cacheAlbDomain))
+		} else if len(cacheUrls) == 0 {
+			for _, r := range runners {
+				// With a cache node, only it serves the binary cache
+				if cacheNode && r.Spec.Role != RoleCache {
+					continue
+				}
+				substituters = append(substituters, pulumi.Sprintf("https://%s", r.PublicDns))
+			}
+		}
+		ctx.Export("nixConfigSnippet", pulumi.All(substituters.ToStringArrayOutput(), cacheKey).ApplyT(func(args []interface{}) string {
+			return nixConfigSnippet(args[0].([]string), args[1].(string))
+		}).(pulumi.StringOutput))
+	}
+
+	// Where the SSM-held secrets live and which version was read, for
+	// tooling that fetches them itself; the values stay in SSM only
+	if gitlabToken != nil || signingKey != nil {
+		params := pulumi.Map{}
+		if gitlabToken != nil {
+			params["gitlabToken"] = pulumi.Map{"name": pulumi.String(gitlabToken.Name), "version": pulumi.Int(gitlabToken.Version)}
+		}
+		if signingKey != nil {
+			params["cacheSigningKey"] = pulumi.Map{"name": pulumi.String(signingKey.Name), "version": pulumi.Int(signingKey.Version)}
+		}
+		ctx.Export("secretParameters", params)
+	}
+
+	if emitTfvars {
+		tfvars := pulumi.StringMap{
+			"n3x_security_group_id": sg.ID().ToStringOutput(),
+		}
+		if keyPair != nil {
+			tfvars["n3x_key_pair_name"] = keyPair.KeyName
+		}
+		for _, r := range runners {
+			prefix := "n3x_" + strings.ReplaceAll(r.Spec.Name, "-", "_")
+			tfvars[prefix+"_instance_id"] = r.InstanceId.ToStringOutput()
+			tfvars[prefix+"_public_ip"] = r.PublicIp
+			tfvars[prefix+"_public_dns"] = r.PublicDns
+		}
+		ctx.Export("tfvars", tfvars.ToStringMapOutput().ApplyT(func(vars map[string]string) string {
+			return formatTfvars(vars)
+		}).(pulumi.StringOutput))
+	}
+
+	return nil
+}
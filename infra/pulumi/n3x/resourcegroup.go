@@ -0,0 +1,20 @@
+package n3x
+
+import "encoding/json"
+
+// resourceGroupQuery returns a TAG_FILTERS_1_0 resource query matching every
+// supported resource carrying this stack's Project and Stack tags.
+func resourceGroupQuery(stack string) (string, error) {
+	query := map[string]any{
+		"ResourceTypeFilters": []string{"AWS::AllSupported"},
+		"TagFilters": []map[string]any{
+			{"Key": "Project", "Values": []string{"n3x"}},
+			{"Key": "Stack", "Values": []string{stack}},
+		},
+	}
+	content, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,840 @@
+package n3x
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ebs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/efs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Config is the resolved stack configuration CreateRunner provisions runners
+// from: the n3x: settings that shape an instance and its volumes, plus the
+// stack-wide resources every runner attaches to. Program fills it in from
+// the stack config; other Pulumi programs can build their own.
+type Config struct {
+	NamePrefix string       // Prefix of the Name tags and AWS resource names
+	Region     string       // AWS region, for the dashboard bodies and links
+	Tags       StandardTags // Tags applied to every resource
+
+	VolumePolicy VolumeTagPolicy // Snapshot-selection and retention tagging
+
+	RootVolumeSize            int
+	RootVolume                VolumeSettings
+	DeleteRootOnTermination   bool
+	DataVolume                VolumeSettings // Cache and ccache volumes
+	CacheVolumeSize           int
+	CacheNodeVolumeSize       int    // Cache volume of the cache node (RoleCache)
+	CacheSnapshotId           string // Source snapshot of the cache volumes (optional)
+	CacheMultiAttach          bool   // Build runners share one Multi-Attach cache volume
+	SharedCacheVolume         VolumeSettings
+	EnableYoctoVolume         bool
+	YoctoVolume               VolumeSettings
+	YoctoVolumeSize           int
+	CcacheVolumeSize          int // 0 for no ccache volume
+	CcacheDeleteOnTermination bool
+	SharedVolumes             []SharedVolumeConfig // Validated n3x:sharedVolumes entries
+	VolumeOutpostArn          pulumi.StringPtrInput
+
+	// Attachment devices, normalized to /dev/sd[f-p]
+	CacheDeviceName  string
+	YoctoDeviceName  string
+	CcacheDeviceName string
+
+	AllowDestroy                bool // Leave instances and persistent volumes unprotected
+	AssociatePublicIp           bool
+	AdditionalSecurityGroupIds  []string
+	CapacityReservationId       string
+	CapacityReservationGroupArn string
+	CapacityBlockId             string // Build runners launch into the Capacity Block
+	CpuCreditSpecification      string // Burstable types only ("" for the AWS default)
+	CreateAlarms                bool
+	CreateDashboard             bool
+	DetailedMonitoring          bool
+	EbsHealthMonitoring         bool
+	EfsMountPath                string
+	EmitLaunchTemplate          bool
+	EnclaveEnabled              bool
+	InstanceScheduleTag         string
+	PinAmi                      bool
+	PrivateDnsHostnameType      string
+	PrivateDnsARecord           bool
+	PrivateDnsAaaaRecord        bool
+	SetHostname                 bool
+
+	// Number of runners in the stack; shared volumes are created with
+	// Multi-Attach when there is more than one.
+	RunnerCount int
+
+	// Stack-wide resources. The optional ones are nil when not created.
+	SecurityGroup        *ec2.SecurityGroup
+	CacheSecurityGroup   *ec2.SecurityGroup
+	KeyName              pulumi.StringPtrInput
+	InstanceProfile      *iam.InstanceProfile
+	CloudWatchAgentParam *ssm.Parameter
+	EfsFileSystem        *efs.FileSystem
+	EfsMountTargets      []pulumi.Resource
+	FastSnapshotRestores []pulumi.Resource // The cache volumes are created after these
+
+	// Private DNS name of the cache node, set once it is created; build
+	// runners created afterwards receive it via user data.
+	CacheHost pulumi.StringInput
+
+	// Resource tally for the summary output; allocated if nil.
+	summary *stackSummary
+
+	// Accumulated across CreateRunner calls for the stack outputs.
+	cost             costEstimate
+	volumeInventory  pulumi.Array // Created EBS volumes (backup tooling)
+	healthAlarms     []pulumi.Resource
+	healthAlarmNames []string // Status check and stalled I/O, for the composite alarm
+
+	// Shared Multi-Attach cache volume, created with the first build runner
+	// (in its AZ) and attached to every build runner after it.
+	sharedCacheVol       *ebs.Volume
+	sharedCacheAz        pulumi.StringOutput
+	sharedCacheInstances pulumi.StringArray
+
+	// n3x:sharedVolumes, created with the first runner (in its AZ) and
+	// attached to every runner; runners after the first follow its AZ.
+	sharedVols           []*ebs.Volume
+	sharedVolsAz         pulumi.StringOutput
+	sharedVolAttachments map[string]pulumi.StringArray
+}
+
+// dataVolumes holds a runner's own EBS data volumes; nil when not created.
+type dataVolumes struct {
+	cache  *ebs.Volume
+	yocto  *ebs.Volume
+	ccache *ebs.Volume
+}
+
+// initState allocates the bookkeeping CreateRunner needs that a Config
+// literal leaves nil.
+func (c *Config) initState() {
+	if c.summary == nil {
+		c.summary = &stackSummary{}
+	}
+	if c.sharedVolAttachments == nil {
+		c.sharedVolAttachments = map[string]pulumi.StringArray{}
+	}
+}
+
+// volumeTags returns the tags for a volume of the given purpose,
+// including the snapshot-selection and retention tags when they apply.
+func (c *Config) volumeTags(purpose string, extra pulumi.StringMap) pulumi.StringMap {
+	return c.Tags.forVolume(purpose, c.VolumePolicy).with(extra)
+}
+
+// recordVolume adds a created EBS volume to the summary, the cost estimate
+// and the volume inventory.
+func (c *Config) recordVolume(runner, purpose string, volumeId pulumi.Input, sizeGb int, settings VolumeSettings) {
+	iops, throughput := settings.effectivePerformance(sizeGb)
+	c.summary.addVolume(sizeGb, iops, throughput)
+	c.cost.addVolume(settings.VolumeType, sizeGb, iops, throughput)
+	c.volumeInventory = append(c.volumeInventory, pulumi.Map{
+		"runner":   pulumi.String(runner),
+		"purpose":  pulumi.String(purpose),
+		"volumeId": volumeId,
+		"sizeGb":   pulumi.Int(sizeGb),
+		"type":     pulumi.String(settings.VolumeType),
+	})
+}
+
+// createVolumeAlarm creates the stalled-I/O alarm of a runner's volume.
+func (c *Config) createVolumeAlarm(ctx *pulumi.Context, runner, purpose string, volumeId pulumi.StringInput) error {
+	name := fmt.Sprintf("%s-%s-%s-stalled-io", c.NamePrefix, runner, purpose)
+	alarm, err := cloudwatch.NewMetricAlarm(ctx, fmt.Sprintf("n3x-%s-%s-io-alarm", runner, purpose), &cloudwatch.MetricAlarmArgs{
+		Name:               pulumi.String(name),
+		AlarmDescription:   pulumi.Sprintf("%s-%s-%s volume stalled I/O", c.NamePrefix, runner, purpose),
+		Namespace:          pulumi.String("AWS/EBS"),
+		MetricName:         pulumi.String("VolumeStalledIOCheck"),
+		Statistic:          pulumi.String("Maximum"),
+		Period:             pulumi.Int(60),
+		EvaluationPeriods:  pulumi.Int(2),
+		Threshold:          pulumi.Float64(1),
+		ComparisonOperator: pulumi.String("GreaterThanOrEqualToThreshold"),
+		Dimensions: pulumi.StringMap{
+			"VolumeId": volumeId,
+		},
+		Tags: c.Tags.with(nil),
+	})
+	if err != nil {
+		return fmt.Errorf("%s volume alarm %s: %w", purpose, runner, err)
+	}
+	c.healthAlarms = append(c.healthAlarms, alarm)
+	c.healthAlarmNames = append(c.healthAlarmNames, name)
+	return nil
+}
+
+// dataDeviceNames returns the attachment device name per data volume purpose.
+func (c *Config) dataDeviceNames() map[string]string {
+	return map[string]string{
+		"zfs-nix-store": c.CacheDeviceName,
+		"yocto-cache":   c.YoctoDeviceName,
+		"ccache":        c.CcacheDeviceName,
+	}
+}
+
+// plannedVolumes returns the volumes a runner will get, for the preview
+// checks and launch templates. With CacheMultiAttach every build runner
+// lists the one shared cache volume.
+func (c *Config) plannedVolumes(spec RunnerSpec) []plannedVolume {
+	vols := []plannedVolume{{"root", c.RootVolumeSize, c.RootVolume}}
+	switch {
+	case spec.Role == RoleCache:
+		return append(vols, plannedVolume{"zfs-nix-store", c.CacheNodeVolumeSize, c.DataVolume})
+	case c.CacheMultiAttach:
+		vols = append(vols, plannedVolume{"zfs-nix-store", c.CacheVolumeSize, c.SharedCacheVolume})
+	default:
+		vols = append(vols, plannedVolume{"zfs-nix-store", c.CacheVolumeSize, c.DataVolume})
+	}
+	if c.EnableYoctoVolume {
+		vols = append(vols, plannedVolume{"yocto-cache", c.YoctoVolumeSize, c.YoctoVolume})
+	}
+	if c.CcacheVolumeSize > 0 {
+		vols = append(vols, plannedVolume{"ccache", c.CcacheVolumeSize, c.DataVolume})
+	}
+	return vols
+}
+
+// createDataVolumes creates a runner's own data volumes in az: the ZFS
+// cache volume (unless the build runners share one via CacheMultiAttach)
+// and, on build runners, the Yocto and ccache volumes. Used with and
+// without instances (n3x:volumesOnly), under the same resource names, so a
+// later full deploy adopts the volumes.
+func (c *Config) createDataVolumes(ctx *pulumi.Context, spec RunnerSpec, az pulumi.StringInput) (*dataVolumes, error) {
+	vols := &dataVolumes{}
+	if !c.CacheMultiAttach || spec.Role == RoleCache {
+		// Cache EBS volume (500GB gp3) — ZFS pool for /nix/store
+		cacheSize := c.CacheVolumeSize
+		if spec.Role == RoleCache {
+			cacheSize = c.CacheNodeVolumeSize
+		}
+		cacheArgs := &ebs.VolumeArgs{
+			AvailabilityZone: az,
+			OutpostArn:       c.VolumeOutpostArn,
+			Size:             pulumi.Int(cacheSize),
+			Type:             pulumi.String(c.DataVolume.VolumeType),
+			// gp3 baseline: 3000 IOPS, 125 MB/s — sufficient for Nix store
+			Tags: c.volumeTags("zfs-nix-store", pulumi.StringMap{
+				"Name":    pulumi.Sprintf("%s-%s-cache", c.NamePrefix, spec.Name),
+				"Purpose": pulumi.String("zfs-nix-store"),
+			}),
+		}
+		if c.CacheSnapshotId != "" {
+			cacheArgs.SnapshotId = pulumi.String(c.CacheSnapshotId)
+		}
+		c.DataVolume.encrypt(cacheArgs)
+		// FSR must be enabled before the volume is created to take effect
+		vol, err := ebs.NewVolume(ctx, fmt.Sprintf("n3x-%s-cache", spec.Name), cacheArgs,
+			pulumi.DependsOn(c.FastSnapshotRestores), pulumi.Protect(!c.AllowDestroy))
+		if err != nil {
+			return nil, fmt.Errorf("cache volume %s: %w", spec.Name, err)
+		}
+		c.recordVolume(spec.Name, "zfs-nix-store", vol.ID(), cacheSize, c.DataVolume)
+		vols.cache = vol
+	}
+	if spec.Role == RoleCache {
+		// The cache node builds nothing
+		return vols, nil
+	}
+
+	if c.EnableYoctoVolume {
+		// Yocto EBS volume (100GB gp3, optional) — DL_DIR/SSTATE_DIR (ephemeral)
+		yoctoArgs := &ebs.VolumeArgs{
+			AvailabilityZone: az,
+			OutpostArn:       c.VolumeOutpostArn,
+			Size:             pulumi.Int(c.YoctoVolumeSize),
+			Type:             pulumi.String(c.YoctoVolume.VolumeType),
+			Tags: c.volumeTags("yocto-cache", pulumi.StringMap{
+				"Name":    pulumi.Sprintf("%s-%s-yocto", c.NamePrefix, spec.Name),
+				"Purpose": pulumi.String("yocto-cache"),
+			}),
+		}
+		if c.YoctoVolume.Iops != 0 {
+			yoctoArgs.Iops = pulumi.Int(c.YoctoVolume.Iops)
+		}
+		if c.YoctoVolume.Throughput != 0 {
+			yoctoArgs.Throughput = pulumi.Int(c.YoctoVolume.Throughput)
+		}
+		c.YoctoVolume.encrypt(yoctoArgs)
+		vol, err := ebs.NewVolume(ctx, fmt.Sprintf("n3x-%s-yocto", spec.Name), yoctoArgs)
+		if err != nil {
+			return nil, fmt.Errorf("yocto volume %s: %w", spec.Name, err)
+		}
+		c.recordVolume(spec.Name, "yocto-cache", vol.ID(), c.YoctoVolumeSize, c.YoctoVolume)
+		vols.yocto = vol
+	}
+
+	// ccache EBS volume (optional) — compiler cache for C/C++ builds
+	if c.CcacheVolumeSize > 0 {
+		ccacheArgs := &ebs.VolumeArgs{
+			AvailabilityZone: az,
+			OutpostArn:       c.VolumeOutpostArn,
+			Size:             pulumi.Int(c.CcacheVolumeSize),
+			Type:             pulumi.String(c.DataVolume.VolumeType),
+			Tags: c.volumeTags("ccache", pulumi.StringMap{
+				"Name":    pulumi.Sprintf("%s-%s-ccache", c.NamePrefix, spec.Name),
+				"Purpose": pulumi.String("ccache"),
+			}),
+		}
+		c.DataVolume.encrypt(ccacheArgs)
+		vol, err := ebs.NewVolume(ctx, fmt.Sprintf("n3x-%s-ccache", spec.Name), ccacheArgs, pulumi.RetainOnDelete(!c.CcacheDeleteOnTermination))
+		if err != nil {
+			return nil, fmt.Errorf("ccache volume %s: %w", spec.Name, err)
+		}
+		c.recordVolume(spec.Name, "ccache", vol.ID(), c.CcacheVolumeSize, c.DataVolume)
+		vols.ccache = vol
+	}
+	return vols, nil
+}
+
+// CreateRunner launches the runner described by spec: its instance, data
+// and shared volumes with their attachments, and the per-runner alarms,
+// dashboard and launch template cfg enables. Runners sharing volumes must
+// be created in order through the same cfg, which tracks them.
+func CreateRunner(ctx *pulumi.Context, cfg *Config, spec RunnerSpec) (*RunnerOutputs, error) {
+	cfg.initState()
+
+	// EC2 instance with custom NixOS AMI (root volume from AMI)
+	rootDevice := &ec2.InstanceRootBlockDeviceArgs{
+		VolumeSize:          pulumi.Int(cfg.RootVolumeSize),
+		VolumeType:          pulumi.String(cfg.RootVolume.VolumeType),
+		DeleteOnTermination: pulumi.Bool(cfg.DeleteRootOnTermination),
+		Tags: cfg.volumeTags("root", pulumi.StringMap{
+			"Name": pulumi.Sprintf("%s-%s-root", cfg.NamePrefix, spec.Name),
+		}),
+	}
+	// Optional fields are only set when configured so AMI/account
+	// defaults (e.g. EBS encryption by default) don't show as drift.
+	if cfg.RootVolume.Iops != 0 {
+		rootDevice.Iops = pulumi.Int(cfg.RootVolume.Iops)
+	}
+	if cfg.RootVolume.Throughput != 0 {
+		rootDevice.Throughput = pulumi.Int(cfg.RootVolume.Throughput)
+	}
+	if cfg.RootVolume.Encrypted {
+		rootDevice.Encrypted = pulumi.Bool(true)
+	}
+	if cfg.RootVolume.KmsKeyId != "" {
+		rootDevice.KmsKeyId = pulumi.String(cfg.RootVolume.KmsKeyId)
+	}
+
+	role, sgId := "gitlab-runner", cfg.SecurityGroup.ID()
+	if spec.Role == RoleCache {
+		role, sgId = "binary-cache", cfg.CacheSecurityGroup.ID()
+	}
+	instanceTags := pulumi.StringMap{
+		"Name":  pulumi.Sprintf("%s-runner-%s", cfg.NamePrefix, spec.Name),
+		"Role":  pulumi.String(role),
+		"NixOS": pulumi.String("true"),
+	}
+	if len(spec.GitlabTags) > 0 {
+		instanceTags["GitLabTags"] = pulumi.String(strings.Join(spec.GitlabTags, ","))
+	}
+	if cfg.InstanceScheduleTag != "" {
+		instanceTags["Schedule"] = pulumi.String(cfg.InstanceScheduleTag)
+	}
+	if cfg.SetHostname {
+		hostname := runnerHostname(cfg.NamePrefix, spec.Name)
+		if len(hostname) > 63 {
+			return nil, configErrorf("setHostname", "shorten n3x:namePrefix or the runner name", "hostname %s is over 63 characters", hostname)
+		}
+		instanceTags["Hostname"] = pulumi.String(hostname)
+	}
+
+	instanceArgs := &ec2.InstanceArgs{
+		Ami:          pulumi.String(spec.AmiId),
+		InstanceType: pulumi.String(spec.InstanceTypes[0]),
+		KeyName:      cfg.KeyName,
+		Monitoring:   pulumi.Bool(cfg.DetailedMonitoring),
+		VpcSecurityGroupIds: append(pulumi.StringArray{
+			sgId,
+		}, pulumi.ToStringArray(cfg.AdditionalSecurityGroupIds)...),
+		RootBlockDevice: rootDevice,
+		Tags:            cfg.Tags.with(instanceTags),
+	}
+	if cfg.InstanceProfile != nil {
+		instanceArgs.IamInstanceProfile = cfg.InstanceProfile.Name
+	}
+	if !cfg.AssociatePublicIp {
+		instanceArgs.AssociatePublicIpAddress = pulumi.Bool(false)
+	}
+	if cfg.SetHostname {
+		// Lets the user data read the Hostname tag from the metadata
+		instanceArgs.MetadataOptions = &ec2.InstanceMetadataOptionsArgs{
+			InstanceMetadataTags: pulumi.String("enabled"),
+		}
+	}
+	if cfg.PrivateDnsHostnameType != "" {
+		instanceArgs.PrivateDnsNameOptions = &ec2.InstancePrivateDnsNameOptionsArgs{
+			HostnameType:                    pulumi.String(cfg.PrivateDnsHostnameType),
+			EnableResourceNameDnsARecord:    pulumi.Bool(cfg.PrivateDnsARecord),
+			EnableResourceNameDnsAaaaRecord: pulumi.Bool(cfg.PrivateDnsAaaaRecord),
+		}
+	}
+	if spec.Ephemeral {
+		// Record the deadline on the instance; it is fixed at launch
+		// (ignoreChanges below), unlike the launch template's tags
+		ephemeralTags := pulumi.StringMap{
+			"TerminateAfter": pulumi.String(time.Now().UTC().Add(time.Duration(spec.TtlHours) * time.Hour).Format(time.RFC3339)),
+		}
+		for k, v := range instanceTags {
+			ephemeralTags[k] = v
+		}
+		instanceArgs.Tags = cfg.Tags.with(ephemeralTags)
+		instanceArgs.InstanceInitiatedShutdownBehavior = pulumi.String("terminate")
+	}
+	// amazon-init runs "#!" user data as a script on boot
+	var script []interface{}
+	if cfg.SetHostname {
+		// Transient, as /etc/hostname is read-only on NixOS. Instances
+		// launched from the launch template carry no Hostname tag and
+		// keep the AMI's hostname.
+		script = append(script, pulumi.String(hostnameScript))
+	}
+	if spec.Role == RoleBuild && cfg.CacheHost != nil {
+		// The runner's NixOS config reads the cache host from this file
+		script = append(script, pulumi.Sprintf("mkdir -p /etc/n3x\necho %s > /etc/n3x/cache-host\n", cfg.CacheHost))
+	}
+	if spec.Role == RoleBuild && cfg.EfsFileSystem != nil {
+		script = append(script, pulumi.Sprintf(
+			"mkdir -p %s\nmount -t nfs4 -o nfsvers=4.1,rsize=1048576,wsize=1048576,hard,timeo=600,retrans=2,noresvport %s:/ %s\n",
+			cfg.EfsMountPath, cfg.EfsFileSystem.DnsName, cfg.EfsMountPath))
+	}
+	if cfg.CloudWatchAgentParam != nil {
+		script = append(script, pulumi.Sprintf(
+			"if command -v amazon-cloudwatch-agent-ctl >/dev/null; then amazon-cloudwatch-agent-ctl -a fetch-config -m ec2 -s -c ssm:%s; fi\n",
+			cfg.CloudWatchAgentParam.Name))
+	}
+	if spec.Ephemeral {
+		// Halting terminates the instance (shutdown behavior above)
+		script = append(script, pulumi.Sprintf("shutdown -h +%d\n", spec.TtlHours*60))
+	}
+	if spec.UserData != "" {
+		script = append(script, pulumi.String(strings.TrimSuffix(spec.UserData, "\n")+"\n"))
+	}
+	var userData pulumi.StringOutput
+	hasUserData := len(script) > 0
+	if hasUserData {
+		userData = pulumi.All(script...).ApplyT(func(parts []interface{}) (string, error) {
+			out := "#!/bin/sh\n"
+			for _, p := range parts {
+				out += p.(string)
+			}
+			if len(out) > maxUserDataBytes {
+				return "", fmt.Errorf("runner %q: user data is %d bytes, over the EC2 limit of %d", spec.Name, len(out), maxUserDataBytes)
+			}
+			return out, nil
+		}).(pulumi.StringOutput)
+		instanceArgs.UserData = userData
+	}
+	if cfg.CapacityReservationId != "" || cfg.CapacityReservationGroupArn != "" {
+		target := &ec2.InstanceCapacityReservationSpecificationCapacityReservationTargetArgs{}
+		if cfg.CapacityReservationId != "" {
+			target.CapacityReservationId = pulumi.String(cfg.CapacityReservationId)
+		} else {
+			target.CapacityReservationResourceGroupArn = pulumi.String(cfg.CapacityReservationGroupArn)
+		}
+		instanceArgs.CapacityReservationSpecification = &ec2.InstanceCapacityReservationSpecificationArgs{
+			CapacityReservationTarget: target,
+		}
+	}
+	if cfg.CapacityBlockId != "" && spec.Role == RoleBuild {
+		instanceArgs.InstanceMarketOptions = &ec2.InstanceInstanceMarketOptionsArgs{
+			MarketType: pulumi.String("capacity-block"),
+		}
+		instanceArgs.CapacityReservationSpecification = &ec2.InstanceCapacityReservationSpecificationArgs{
+			CapacityReservationTarget: &ec2.InstanceCapacityReservationSpecificationCapacityReservationTargetArgs{
+				CapacityReservationId: pulumi.String(cfg.CapacityBlockId),
+			},
+		}
+	}
+	if cfg.EnclaveEnabled && spec.Role == RoleBuild {
+		instanceArgs.EnclaveOptions = &ec2.InstanceEnclaveOptionsArgs{
+			Enabled: pulumi.Bool(true),
+		}
+	}
+	if cfg.CpuCreditSpecification != "" && isBurstable(spec.InstanceTypes[0]) {
+		instanceArgs.CreditSpecification = &ec2.InstanceCreditSpecificationArgs{
+			CpuCredits: pulumi.String(cfg.CpuCreditSpecification),
+		}
+	}
+	if spec.SubnetId != "" {
+		instanceArgs.SubnetId = pulumi.String(spec.SubnetId)
+	}
+	if spec.PrivateIp != "" {
+		instanceArgs.PrivateIp = pulumi.String(spec.PrivateIp)
+	}
+	if spec.AvailabilityZone != "" {
+		instanceArgs.AvailabilityZone = pulumi.String(spec.AvailabilityZone)
+	}
+	if cfg.sharedCacheVol != nil {
+		// Multi-Attach only works within one AZ
+		instanceArgs.AvailabilityZone = cfg.sharedCacheAz
+	}
+	if cfg.sharedVols != nil {
+		instanceArgs.AvailabilityZone = cfg.sharedVolsAz
+	}
+	if spec.NetworkInterfaceId != "" {
+		// The existing ENI brings its own subnet, private IP and security
+		// groups; AWS rejects instance-level SGs alongside it.
+		instanceArgs.VpcSecurityGroupIds = nil
+		instanceArgs.SubnetId = nil
+		instanceArgs.AssociatePublicIpAddress = nil
+		instanceArgs.NetworkInterfaces = ec2.InstanceNetworkInterfaceArray{
+			&ec2.InstanceNetworkInterfaceArgs{
+				DeviceIndex:        pulumi.Int(0),
+				NetworkInterfaceId: pulumi.String(spec.NetworkInterfaceId),
+			},
+		}
+	}
+	instanceOpts := []pulumi.ResourceOption{pulumi.Protect(!cfg.AllowDestroy && !spec.Ephemeral)}
+	if spec.Role == RoleBuild && len(cfg.EfsMountTargets) > 0 {
+		// The first boot mounts EFS, which needs the mount targets
+		instanceOpts = append(instanceOpts, pulumi.DependsOn(cfg.EfsMountTargets))
+	}
+	if cfg.PinAmi {
+		// Keep the running AMI even if amiX86/amiArm64 changes
+		instanceOpts = append(instanceOpts, pulumi.IgnoreChanges([]string{"ami"}))
+	}
+	if spec.Ephemeral {
+		instanceOpts = append(instanceOpts, pulumi.IgnoreChanges([]string{`tags["TerminateAfter"]`}))
+	}
+	instance, err := ec2.NewInstance(ctx, fmt.Sprintf("n3x-runner-%s", spec.Name), instanceArgs, instanceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("instance %s: %w", spec.Name, err)
+	}
+	cfg.summary.instances++
+	cfg.cost.addInstance(spec.InstanceTypes[0])
+	cfg.recordVolume(spec.Name, "root", instance.RootBlockDevice.VolumeId(), cfg.RootVolumeSize, cfg.RootVolume)
+
+	// Status check alarm (no actions — visible in the CloudWatch console)
+	if cfg.CreateAlarms {
+		name := fmt.Sprintf("%s-%s-status-check", cfg.NamePrefix, spec.Name)
+		alarm, err := cloudwatch.NewMetricAlarm(ctx, fmt.Sprintf("n3x-%s-status-alarm", spec.Name), &cloudwatch.MetricAlarmArgs{
+			Name:               pulumi.String(name),
+			AlarmDescription:   pulumi.Sprintf("%s-runner-%s failed EC2 status checks", cfg.NamePrefix, spec.Name),
+			Namespace:          pulumi.String("AWS/EC2"),
+			MetricName:         pulumi.String("StatusCheckFailed"),
+			Statistic:          pulumi.String("Maximum"),
+			Period:             pulumi.Int(60),
+			EvaluationPeriods:  pulumi.Int(2),
+			Threshold:          pulumi.Float64(1),
+			ComparisonOperator: pulumi.String("GreaterThanOrEqualToThreshold"),
+			Dimensions: pulumi.StringMap{
+				"InstanceId": instance.ID().ToStringOutput(),
+			},
+			Tags: cfg.Tags.with(nil),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("status alarm %s: %w", spec.Name, err)
+		}
+		cfg.healthAlarms = append(cfg.healthAlarms, alarm)
+		cfg.healthAlarmNames = append(cfg.healthAlarmNames, name)
+	}
+
+	for i, sv := range cfg.SharedVolumes {
+		if cfg.sharedVols == nil {
+			cfg.sharedVols = make([]*ebs.Volume, len(cfg.SharedVolumes))
+			cfg.sharedVolsAz = instance.AvailabilityZone
+		}
+		if cfg.sharedVols[i] == nil {
+			settings := sv.settings()
+			settings.Encrypted, settings.KmsKeyId = cfg.DataVolume.Encrypted, cfg.DataVolume.KmsKeyId
+			svArgs := &ebs.VolumeArgs{
+				AvailabilityZone:   instance.AvailabilityZone,
+				Type:               pulumi.String(settings.VolumeType),
+				MultiAttachEnabled: pulumi.Bool(cfg.RunnerCount > 1),
+				Tags: cfg.volumeTags("shared", pulumi.StringMap{
+					"Name":    pulumi.Sprintf("%s-shared-%s", cfg.NamePrefix, sv.Name),
+					"Purpose": pulumi.String("shared"),
+				}),
+			}
+			if sv.SizeGb > 0 {
+				svArgs.Size = pulumi.Int(sv.SizeGb)
+			}
+			if settings.Iops != 0 {
+				svArgs.Iops = pulumi.Int(settings.Iops)
+			}
+			if sv.SnapshotId != "" {
+				svArgs.SnapshotId = pulumi.String(sv.SnapshotId)
+			}
+			settings.encrypt(svArgs)
+			vol, err := ebs.NewVolume(ctx, fmt.Sprintf("n3x-shared-%s", sv.Name), svArgs, pulumi.Protect(!cfg.AllowDestroy))
+			if err != nil {
+				return nil, fmt.Errorf("shared volume %s: %w", sv.Name, err)
+			}
+			cfg.sharedVols[i] = vol
+			cfg.recordVolume("shared", sv.Name, vol.ID(), sv.SizeGb, settings)
+		}
+
+		_, err = ec2.NewVolumeAttachment(ctx, fmt.Sprintf("n3x-%s-shared-%s-attach", spec.Name, sv.Name), &ec2.VolumeAttachmentArgs{
+			InstanceId: instance.ID(),
+			VolumeId:   cfg.sharedVols[i].ID(),
+			DeviceName: pulumi.String(sv.DeviceName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("shared volume %s attach %s: %w", sv.Name, spec.Name, err)
+		}
+		cfg.summary.attachments++
+		cfg.sharedVolAttachments[sv.Name] = append(cfg.sharedVolAttachments[sv.Name], instance.ID().ToStringOutput())
+	}
+
+	// Data volumes go in the runner's AZ, known up front when it has
+	// an assigned subnet or a pinned AZ
+	var volumeAz pulumi.StringInput = instance.AvailabilityZone
+	if spec.VolumeAz != "" {
+		volumeAz = pulumi.String(spec.VolumeAz)
+	}
+	vols, err := cfg.createDataVolumes(ctx, spec, volumeAz)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.CacheMultiAttach && spec.Role == RoleBuild {
+		// Shared io2 cache volume — one ZFS pool, attached to every build runner
+		if cfg.sharedCacheVol == nil {
+			sharedArgs := &ebs.VolumeArgs{
+				AvailabilityZone:   instance.AvailabilityZone,
+				Size:               pulumi.Int(cfg.CacheVolumeSize),
+				Type:               pulumi.String(cfg.SharedCacheVolume.VolumeType),
+				Iops:               pulumi.Int(cfg.SharedCacheVolume.Iops),
+				MultiAttachEnabled: pulumi.Bool(true),
+				Tags: cfg.volumeTags("zfs-nix-store", pulumi.StringMap{
+					"Name":    pulumi.Sprintf("%s-shared-cache", cfg.NamePrefix),
+					"Purpose": pulumi.String("zfs-nix-store"),
+				}),
+			}
+			if cfg.CacheSnapshotId != "" {
+				sharedArgs.SnapshotId = pulumi.String(cfg.CacheSnapshotId)
+			}
+			cfg.SharedCacheVolume.encrypt(sharedArgs)
+			cfg.sharedCacheVol, err = ebs.NewVolume(ctx, "n3x-shared-cache", sharedArgs,
+				pulumi.DependsOn(cfg.FastSnapshotRestores), pulumi.Protect(!cfg.AllowDestroy))
+			if err != nil {
+				return nil, fmt.Errorf("shared cache volume: %w", err)
+			}
+			cfg.sharedCacheAz = instance.AvailabilityZone
+			cfg.recordVolume("shared", "zfs-nix-store", cfg.sharedCacheVol.ID(), cfg.CacheVolumeSize, cfg.SharedCacheVolume)
+			if cfg.EbsHealthMonitoring {
+				if err := cfg.createVolumeAlarm(ctx, "shared", "cache", cfg.sharedCacheVol.ID().ToStringOutput()); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		_, err = ec2.NewVolumeAttachment(ctx, fmt.Sprintf("n3x-%s-shared-cache-attach", spec.Name), &ec2.VolumeAttachmentArgs{
+			InstanceId: instance.ID(),
+			VolumeId:   cfg.sharedCacheVol.ID(),
+			DeviceName: pulumi.String(cfg.CacheDeviceName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("shared cache attach %s: %w", spec.Name, err)
+		}
+		cfg.summary.attachments++
+		cfg.sharedCacheInstances = append(cfg.sharedCacheInstances, instance.ID().ToStringOutput())
+	} else {
+		// Cache volume attached as cfg.CacheDeviceName; the in-guest path (NVMe
+		// on Nitro) is in the deviceMappings output
+		_, err = ec2.NewVolumeAttachment(ctx, fmt.Sprintf("n3x-%s-cache-attach", spec.Name), &ec2.VolumeAttachmentArgs{
+			InstanceId: instance.ID(),
+			VolumeId:   vols.cache.ID(),
+			DeviceName: pulumi.String(cfg.CacheDeviceName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cache attach %s: %w", spec.Name, err)
+		}
+		cfg.summary.attachments++
+		if cfg.EbsHealthMonitoring {
+			if err := cfg.createVolumeAlarm(ctx, spec.Name, "cache", vols.cache.ID().ToStringOutput()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	outputs := &RunnerOutputs{
+		Spec:       spec,
+		InstanceId: instance.ID(),
+		PublicIp:   instance.PublicIp,
+		PublicDns:  instance.PublicDns,
+		PrivateIp:  instance.PrivateIp,
+		PrivateDns: instance.PrivateDns,
+
+		SecurityGroupIds: instance.VpcSecurityGroupIds,
+		RootVolumeId:     instance.RootBlockDevice.VolumeId().Elem(),
+	}
+	if spec.Ephemeral {
+		outputs.TerminateAfter = instance.Tags.MapIndex(pulumi.String("TerminateAfter"))
+	}
+
+	if cfg.CreateDashboard {
+		dashboardName := fmt.Sprintf("%s-runner-%s", cfg.NamePrefix, spec.Name)
+		body := instance.ID().ToStringOutput().ApplyT(func(id string) (string, error) {
+			return runnerDashboardBody(cfg.Region, id)
+		}).(pulumi.StringOutput)
+		dashboard, err := cloudwatch.NewDashboard(ctx, fmt.Sprintf("n3x-%s-dashboard", spec.Name), &cloudwatch.DashboardArgs{
+			DashboardName: pulumi.String(dashboardName),
+			DashboardBody: body,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("dashboard %s: %w", spec.Name, err)
+		}
+		outputs.DashboardUrl = dashboard.DashboardName.ApplyT(func(name string) string {
+			return dashboardUrl(cfg.Region, name)
+		}).(pulumi.StringOutput)
+	}
+	if cfg.EmitLaunchTemplate {
+		// Root plus the runner's data volumes, created fresh per launch
+		var mappings ec2.LaunchTemplateBlockDeviceMappingArray
+		deviceNames := cfg.dataDeviceNames()
+		for _, v := range cfg.plannedVolumes(spec) {
+			ebsArgs := &ec2.LaunchTemplateBlockDeviceMappingEbsArgs{
+				VolumeSize:          pulumi.Int(v.sizeGb),
+				VolumeType:          pulumi.String(v.settings.VolumeType),
+				DeleteOnTermination: pulumi.String("true"),
+			}
+			if v.purpose == "root" && !cfg.DeleteRootOnTermination {
+				ebsArgs.DeleteOnTermination = pulumi.String("false")
+			}
+			if v.settings.Iops != 0 {
+				ebsArgs.Iops = pulumi.Int(v.settings.Iops)
+			}
+			if v.settings.Throughput != 0 {
+				ebsArgs.Throughput = pulumi.Int(v.settings.Throughput)
+			}
+			if v.settings.Encrypted {
+				ebsArgs.Encrypted = pulumi.String("true")
+			}
+			if v.settings.KmsKeyId != "" {
+				ebsArgs.KmsKeyId = pulumi.String(v.settings.KmsKeyId)
+			}
+			if v.purpose == "zfs-nix-store" && cfg.CacheSnapshotId != "" {
+				ebsArgs.SnapshotId = pulumi.String(cfg.CacheSnapshotId)
+			}
+			device := spec.RootDeviceName
+			if v.purpose != "root" {
+				device = deviceNames[v.purpose]
+			}
+			mappings = append(mappings, &ec2.LaunchTemplateBlockDeviceMappingArgs{
+				DeviceName: pulumi.String(device),
+				Ebs:        ebsArgs,
+			})
+		}
+		templateArgs := &ec2.LaunchTemplateArgs{
+			Name:                pulumi.Sprintf("%s-runner-%s", cfg.NamePrefix, spec.Name),
+			Description:         pulumi.Sprintf("n3x %s runner (not launched by Pulumi)", spec.Name),
+			ImageId:             pulumi.String(spec.AmiId),
+			InstanceType:        pulumi.String(spec.InstanceTypes[0]),
+			KeyName:             cfg.KeyName,
+			VpcSecurityGroupIds: append(pulumi.StringArray{sgId}, pulumi.ToStringArray(cfg.AdditionalSecurityGroupIds)...),
+			BlockDeviceMappings: mappings,
+			Monitoring: &ec2.LaunchTemplateMonitoringArgs{
+				Enabled: pulumi.Bool(cfg.DetailedMonitoring),
+			},
+			TagSpecifications: ec2.LaunchTemplateTagSpecificationArray{
+				&ec2.LaunchTemplateTagSpecificationArgs{
+					ResourceType: pulumi.String("instance"),
+					Tags:         cfg.Tags.with(instanceTags),
+				},
+				&ec2.LaunchTemplateTagSpecificationArgs{
+					ResourceType: pulumi.String("volume"),
+					Tags:         cfg.Tags.with(pulumi.StringMap{"Name": pulumi.Sprintf("%s-%s-adhoc", cfg.NamePrefix, spec.Name)}),
+				},
+			},
+			UpdateDefaultVersion: pulumi.Bool(true),
+			Tags:                 cfg.Tags.with(nil),
+		}
+		if hasUserData {
+			templateArgs.UserData = userData.ApplyT(func(script string) string {
+				return base64.StdEncoding.EncodeToString([]byte(script))
+			}).(pulumi.StringOutput)
+		}
+		if !cfg.AssociatePublicIp {
+			// The public IP setting lives on the interface, which
+			// then carries the security groups too
+			templateArgs.NetworkInterfaces = ec2.LaunchTemplateNetworkInterfaceArray{
+				&ec2.LaunchTemplateNetworkInterfaceArgs{
+					DeviceIndex:              pulumi.Int(0),
+					AssociatePublicIpAddress: pulumi.String("false"),
+					SecurityGroups:           templateArgs.VpcSecurityGroupIds,
+				},
+			}
+			templateArgs.VpcSecurityGroupIds = nil
+		}
+		if cfg.InstanceProfile != nil {
+			templateArgs.IamInstanceProfile = &ec2.LaunchTemplateIamInstanceProfileArgs{
+				Name: cfg.InstanceProfile.Name,
+			}
+		}
+		if cfg.PrivateDnsHostnameType != "" {
+			templateArgs.PrivateDnsNameOptions = &ec2.LaunchTemplatePrivateDnsNameOptionsArgs{
+				HostnameType:                    pulumi.String(cfg.PrivateDnsHostnameType),
+				EnableResourceNameDnsARecord:    pulumi.Bool(cfg.PrivateDnsARecord),
+				EnableResourceNameDnsAaaaRecord: pulumi.Bool(cfg.PrivateDnsAaaaRecord),
+			}
+		}
+		if cfg.EnclaveEnabled && spec.Role == RoleBuild {
+			templateArgs.EnclaveOptions = &ec2.LaunchTemplateEnclaveOptionsArgs{
+				Enabled: pulumi.Bool(true),
+			}
+		}
+		template, err := ec2.NewLaunchTemplate(ctx, fmt.Sprintf("n3x-%s-launch-template", spec.Name), templateArgs)
+		if err != nil {
+			return nil, fmt.Errorf("launch template %s: %w", spec.Name, err)
+		}
+		outputs.LaunchTemplateId = template.ID()
+		outputs.LaunchTemplateVersion = template.LatestVersion
+	}
+
+	if spec.Role == RoleCache {
+		// The cache node serves caches only; it builds nothing
+		return outputs, nil
+	}
+
+	if vols.yocto != nil {
+		// Yocto volume attached as cfg.YoctoDeviceName (guest path in deviceMappings)
+		_, err = ec2.NewVolumeAttachment(ctx, fmt.Sprintf("n3x-%s-yocto-attach", spec.Name), &ec2.VolumeAttachmentArgs{
+			InstanceId: instance.ID(),
+			VolumeId:   vols.yocto.ID(),
+			DeviceName: pulumi.String(cfg.YoctoDeviceName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("yocto attach %s: %w", spec.Name, err)
+		}
+		cfg.summary.attachments++
+		if cfg.EbsHealthMonitoring {
+			if err := cfg.createVolumeAlarm(ctx, spec.Name, "yocto", vols.yocto.ID().ToStringOutput()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if vols.ccache != nil {
+		// ccache volume attached as cfg.CcacheDeviceName (guest path in deviceMappings)
+		_, err = ec2.NewVolumeAttachment(ctx, fmt.Sprintf("n3x-%s-ccache-attach", spec.Name), &ec2.VolumeAttachmentArgs{
+			InstanceId: instance.ID(),
+			VolumeId:   vols.ccache.ID(),
+			DeviceName: pulumi.String(cfg.CcacheDeviceName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ccache attach %s: %w", spec.Name, err)
+		}
+		cfg.summary.attachments++
+		if cfg.EbsHealthMonitoring {
+			if err := cfg.createVolumeAlarm(ctx, spec.Name, "ccache", vols.ccache.ID().ToStringOutput()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return outputs, nil
+}
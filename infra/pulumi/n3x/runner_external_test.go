@@ -0,0 +1,88 @@
+package n3x_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n3x/infra/n3x"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// echoMocks echoes resource inputs back as outputs.
+type echoMocks struct{}
+
+func (echoMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	return args.Name + "-id", args.Inputs, nil
+}
+
+func (echoMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+// TestCreateRunner provisions a runner through the exported API only, the
+// way another Pulumi program would.
+func TestCreateRunner(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		sg, err := ec2.NewSecurityGroup(ctx, "ci-sg", &ec2.SecurityGroupArgs{})
+		if err != nil {
+			return err
+		}
+		cfg := &n3x.Config{
+			NamePrefix:                 "ci",
+			Region:                     "us-east-1",
+			Tags:                       n3x.StandardTags{"Project": "n3x"},
+			RootVolumeSize:             50,
+			RootVolume:                 n3x.VolumeSettings{VolumeType: "gp3"},
+			DataVolume:                 n3x.VolumeSettings{VolumeType: "gp3"},
+			CacheVolumeSize:            500,
+			CacheDeviceName:            "/dev/sdf",
+			AssociatePublicIp:          true,
+			AdditionalSecurityGroupIds: []string{"sg-extra"},
+			EmitLaunchTemplate:         true,
+			RunnerCount:                1,
+			SecurityGroup:              sg,
+		}
+		spec := n3x.RunnerSpec{
+			Name:           "x86",
+			InstanceTypes:  []string{"c6i.2xlarge"},
+			AmiId:          "ami-1",
+			RootDeviceName: "/dev/xvda",
+			Ephemeral:      true,
+			TtlHours:       4,
+		}
+		r, err := n3x.CreateRunner(ctx, cfg, spec)
+		if err != nil {
+			return err
+		}
+		if r.Spec.Name != "x86" {
+			t.Errorf("Spec.Name = %q, want x86", r.Spec.Name)
+		}
+		pulumi.All(r.InstanceId, r.SecurityGroupIds, r.TerminateAfter, r.LaunchTemplateId).ApplyT(func(all []interface{}) error {
+			defer wg.Done()
+			if id := all[0].(pulumi.ID); id != "n3x-runner-x86-id" {
+				t.Errorf("InstanceId = %q", id)
+			}
+			if sgs := all[1].([]string); !slices.Equal(sgs, []string{"ci-sg-id", "sg-extra"}) {
+				t.Errorf("SecurityGroupIds = %v, want the stack and additional groups", sgs)
+			}
+			if _, err := time.Parse(time.RFC3339, all[2].(string)); err != nil {
+				t.Errorf("TerminateAfter: %v", err)
+			}
+			if id := all[3].(pulumi.ID); id != "n3x-x86-launch-template-id" {
+				t.Errorf("LaunchTemplateId = %q", id)
+			}
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("n3x", "test", echoMocks{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+}
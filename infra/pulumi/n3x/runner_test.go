@@ -0,0 +1,73 @@
+package n3x
+
+import (
+	"testing"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// mocks echoes resource inputs back as outputs.
+type mocks struct{}
+
+func (mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	return args.Name + "-id", args.Inputs, nil
+}
+
+func (mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+func TestCreateRunnerSharedVolumes(t *testing.T) {
+	cfg := &Config{
+		NamePrefix:      "n3x",
+		Region:          "us-east-1",
+		Tags:            StandardTags{"Project": "n3x"},
+		RootVolumeSize:  50,
+		RootVolume:      VolumeSettings{VolumeType: "gp3"},
+		DataVolume:      VolumeSettings{VolumeType: "gp3"},
+		CacheVolumeSize: 500,
+		CacheDeviceName: "/dev/sdf",
+		SharedVolumes: []SharedVolumeConfig{
+			{Name: "tools", SizeGb: 10, DeviceName: "/dev/sdj", VolumeType: "io2", Iops: 3000},
+		},
+		AssociatePublicIp: true,
+		AllowDestroy:      true,
+		RunnerCount:       2,
+	}
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		sg, err := ec2.NewSecurityGroup(ctx, "sg", &ec2.SecurityGroupArgs{})
+		if err != nil {
+			return err
+		}
+		cfg.SecurityGroup = sg
+		for _, name := range []string{"x86", "graviton"} {
+			r, err := CreateRunner(ctx, cfg, RunnerSpec{Name: name, InstanceTypes: []string{"c6i.2xlarge"}, AmiId: "ami-1"})
+			if err != nil {
+				return err
+			}
+			if r.Spec.Name != name {
+				t.Errorf("Spec.Name = %q, want %q", r.Spec.Name, name)
+			}
+		}
+		return nil
+	}, pulumi.WithMocks("n3x", "test", mocks{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Per runner: root and cache volumes; the shared volume once
+	if got := len(cfg.volumeInventory); got != 5 {
+		t.Errorf("%d volumes recorded, want 5", got)
+	}
+	if cfg.summary.instances != 2 || cfg.summary.attachments != 4 {
+		t.Errorf("summary: %d instances, %d attachments; want 2, 4", cfg.summary.instances, cfg.summary.attachments)
+	}
+	if len(cfg.sharedVols) != 1 {
+		t.Errorf("%d shared volumes, want 1", len(cfg.sharedVols))
+	}
+	if got := len(cfg.sharedVolAttachments["tools"]); got != 2 {
+		t.Errorf("tools attached to %d runners, want 2", got)
+	}
+}
@@ -0,0 +1,217 @@
+package n3x
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// runnerNamePattern restricts runner names to what is safe in resource names,
+// Name tags and output keys (e.g. "<name>InstanceId").
+var runnerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,30}$`)
+
+// runnerFileEntry is one runner in an n3x:runnersFile JSON document.
+// instanceTypes may be omitted to use the profile default for the AMI's
+// architecture. ami may be omitted to use n3x:amisByArch (or amiX86/amiArm64)
+// for the declared architecture, else the first instance type's:
+//
+//	[
+//	  {"name": "x86", "ami": "ami-...", "instanceTypes": ["c6i.2xlarge"]},
+//	  {"name": "graviton", "ami": "ami-...", "instanceTypes": ["c7g.2xlarge", "m7g.2xlarge"],
+//	   "gitlabTags": ["nix", "aarch64"]}
+//	]
+type runnerFileEntry struct {
+	Name               string   `json:"name"`
+	Ami                string   `json:"ami,omitempty"`
+	Architecture       string   `json:"architecture,omitempty"`
+	InstanceTypes      []string `json:"instanceTypes,omitempty"`
+	NetworkInterfaceId string   `json:"networkInterfaceId,omitempty"`
+	GitlabTags         []string `json:"gitlabTags,omitempty"`
+	PrivateIp          string   `json:"privateIp,omitempty"`
+	UserData           string   `json:"userData,omitempty"`
+	Ephemeral          bool     `json:"ephemeral,omitempty"`
+	TtlHours           int      `json:"ttlHours,omitempty"`
+	SpotInstanceTypes  []string `json:"spotInstanceTypes,omitempty"`
+}
+
+// loadRunnersFile reads and parses the runner definitions at path. Syntax and
+// type errors are reported with the line and column they occur at.
+func loadRunnersFile(path string) ([]RunnerSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var entries []runnerFileEntry
+	if err := dec.Decode(&entries); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, col := lineCol(data, syntaxErr.Offset)
+			return nil, fmt.Errorf("%s:%d:%d: %w", path, line, col, err)
+		case errors.As(err, &typeErr):
+			line, col := lineCol(data, typeErr.Offset)
+			return nil, fmt.Errorf("%s:%d:%d: %w", path, line, col, err)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no runners defined", path)
+	}
+
+	specs := make([]RunnerSpec, 0, len(entries))
+	for _, e := range entries {
+		if e.Architecture != "" && e.Architecture != "x86_64" && e.Architecture != "arm64" {
+			return nil, fmt.Errorf("%s: runner %q: architecture %q must be x86_64 or arm64", path, e.Name, e.Architecture)
+		}
+		if e.Ephemeral && e.TtlHours <= 0 {
+			return nil, fmt.Errorf("%s: runner %q: ephemeral requires a positive ttlHours", path, e.Name)
+		}
+		if !e.Ephemeral && e.TtlHours != 0 {
+			return nil, fmt.Errorf("%s: runner %q: ttlHours requires ephemeral", path, e.Name)
+		}
+		specs = append(specs, RunnerSpec{
+			Name:               e.Name,
+			InstanceTypes:      e.InstanceTypes,
+			AmiId:              e.Ami,
+			NetworkInterfaceId: e.NetworkInterfaceId,
+			GitlabTags:         e.GitlabTags,
+			PrivateIp:          e.PrivateIp,
+			Architecture:       e.Architecture,
+			UserData:           e.UserData,
+			Ephemeral:          e.Ephemeral,
+			TtlHours:           e.TtlHours,
+			SpotInstanceTypes:  e.SpotInstanceTypes,
+			FromFile:           true,
+		})
+	}
+	return specs, nil
+}
+
+// lineCol converts a byte offset in data to a 1-based line and column.
+func lineCol(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// builtinRunnerKeys maps the settings of the built-in runners to the n3x
+// keys they are configured by.
+var builtinRunnerKeys = map[string]map[string]string{
+	"x86": {
+		"ami":                "amiX86",
+		"instanceTypes":      "instanceTypesX86",
+		"spotInstanceTypes":  "spotInstanceTypesX86",
+		"gitlabTags":         "gitlabTagsX86",
+		"privateIp":          "privateIp",
+		"networkInterfaceId": "networkInterfaceId",
+	},
+	"graviton": {
+		"ami":                "amiArm64",
+		"instanceTypes":      "instanceTypesGraviton",
+		"spotInstanceTypes":  "spotInstanceTypesGraviton",
+		"gitlabTags":         "gitlabTagsGraviton",
+		"privateIp":          "privateIpGraviton",
+		"networkInterfaceId": "networkInterfaceIdGraviton",
+	},
+	"cache": {
+		"ami":           "amiX86",
+		"instanceTypes": "cacheNodeInstanceType",
+	},
+}
+
+// configKey returns the n3x key a runner setting (a runnersFile field name,
+// e.g. "privateIp") comes from, for ConfigErrors: runnersFile for its
+// entries, otherwise the built-in runner's own key.
+func (s RunnerSpec) configKey(setting string) string {
+	if key, ok := builtinRunnerKeys[s.Name][setting]; ok && !s.FromFile {
+		return key
+	}
+	return "runnersFile"
+}
+
+// validateRunnerSpecs checks a runner list before any resources are created:
+// names are well-formed and unique, every runner has an AMI and a valid
+// instance-type list, and no ENI or private IP is claimed by two runners.
+func validateRunnerSpecs(specs []RunnerSpec) error {
+	names := map[string]bool{}
+	enis := map[string]string{}
+	ips := map[string]string{}
+	for i, s := range specs {
+		if !runnerNamePattern.MatchString(s.Name) {
+			return configErrorf(s.configKey("name"), "", "runner %d: name %q must be lowercase letters, digits and hyphens", i, s.Name)
+		}
+		if names[s.Name] {
+			return configErrorf(s.configKey("name"), "rename one of them", "runner %q defined more than once", s.Name)
+		}
+		names[s.Name] = true
+
+		if s.AmiId == "" {
+			key, hint := s.configKey("ami"), "set ami, or n3x:amisByArch for its architecture"
+			if key != "runnersFile" {
+				hint = "set n3x:" + key
+			}
+			return configErrorf(key, hint, "runner %q: no AMI", s.Name)
+		}
+		if err := validateInstanceTypes(s.InstanceTypes); err != nil {
+			return configErrorf(s.configKey("instanceTypes"), "", "runner %q: %w", s.Name, err)
+		}
+		if len(s.SpotInstanceTypes) > 0 {
+			if err := validateInstanceTypes(s.SpotInstanceTypes); err != nil {
+				return configErrorf(s.configKey("spotInstanceTypes"), "", "runner %q: spotInstanceTypes: %w", s.Name, err)
+			}
+		}
+		for _, tag := range s.GitlabTags {
+			if tag == "" || strings.ContainsAny(tag, ", \t") {
+				return configErrorf(s.configKey("gitlabTags"), "", "runner %q: GitLab tag %q must be non-empty without commas or whitespace", s.Name, tag)
+			}
+		}
+		if s.NetworkInterfaceId != "" {
+			if !strings.HasPrefix(s.NetworkInterfaceId, "eni-") {
+				return configErrorf(s.configKey("networkInterfaceId"), "", "runner %q: networkInterfaceId %q: expected an ENI ID (eni-...)", s.Name, s.NetworkInterfaceId)
+			}
+			if other, ok := enis[s.NetworkInterfaceId]; ok {
+				return configErrorf(s.configKey("networkInterfaceId"), "an ENI attaches to one instance", "runners %q and %q both use ENI %s", other, s.Name, s.NetworkInterfaceId)
+			}
+			enis[s.NetworkInterfaceId] = s.Name
+		}
+		if s.PrivateIp != "" {
+			if s.NetworkInterfaceId != "" {
+				return configErrorf(s.configKey("privateIp"), "drop either privateIp or networkInterfaceId",
+					"runner %q: privateIp cannot be combined with networkInterfaceId (the ENI has its own address)", s.Name)
+			}
+			if other, ok := ips[s.PrivateIp]; ok {
+				return configErrorf(s.configKey("privateIp"), "give each runner its own address", "runners %q and %q both use private IP %s", other, s.Name, s.PrivateIp)
+			}
+			ips[s.PrivateIp] = s.Name
+		}
+	}
+	return nil
+}
+
+// runnerHostname is the OS hostname n3x:setHostname gives a runner: its
+// resource name (the Name tag), lowercased for DNS.
+func runnerHostname(namePrefix, name string) string {
+	return strings.ToLower(namePrefix + "-runner-" + name)
+}
+
+// hostnameScript sets the transient hostname from the instance's Hostname
+// tag, read through IMDSv2 (needs instance metadata tags enabled). It leaves
+// the hostname alone when the tag or curl is missing.
+const hostnameScript = `if command -v curl >/dev/null; then
+  token=$(curl -sf -X PUT -H 'X-aws-ec2-metadata-token-ttl-seconds: 60' http://169.254.169.254/latest/api/token)
+  name=$(curl -sf -H "X-aws-ec2-metadata-token: $token" http://169.254.169.254/latest/meta-data/tags/instance/Hostname) &&
+    hostnamectl --transient set-hostname "$name"
+fi
+`
@@ -0,0 +1,110 @@
+package n3x
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// sgRule is a single security group rule. Both the security group's
+// ingress/egress arguments and the securityGroupRules output are built from
+// the same rules, so the output always matches what was configured.
+type sgRule struct {
+	protocol    string // "tcp", "udp", "icmp" or "-1" (all)
+	fromPort    int
+	toPort      int
+	cidrBlocks  []string
+	description string
+}
+
+// ruleConfig is one security group rule as written in config (e.g.
+// n3x:extraIngressRules). Field names match the securityGroupRules output.
+type ruleConfig struct {
+	Protocol    string   `json:"protocol"`
+	FromPort    int      `json:"fromPort"`
+	ToPort      int      `json:"toPort"`
+	CidrBlocks  []string `json:"cidrBlocks"`
+	Description string   `json:"description"`
+}
+
+// toRule validates a configured rule and converts it to an sgRule. A
+// description is mandatory so every opened port is auditable.
+func (c ruleConfig) toRule() (sgRule, error) {
+	if c.Description == "" {
+		return sgRule{}, fmt.Errorf("description is required")
+	}
+	switch c.Protocol {
+	case "tcp", "udp":
+		if c.FromPort < 0 || c.ToPort > 65535 || c.FromPort > c.ToPort {
+			return sgRule{}, fmt.Errorf("%q: invalid port range %d-%d", c.Description, c.FromPort, c.ToPort)
+		}
+	case "icmp", "-1":
+		// Ports carry ICMP type/code (or are ignored for "-1")
+	default:
+		return sgRule{}, fmt.Errorf("%q: protocol %q must be tcp, udp, icmp or -1", c.Description, c.Protocol)
+	}
+	if len(c.CidrBlocks) == 0 {
+		return sgRule{}, fmt.Errorf("%q: at least one CIDR block is required", c.Description)
+	}
+	for _, cidr := range c.CidrBlocks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return sgRule{}, fmt.Errorf("%q: %w", c.Description, err)
+		}
+	}
+	return sgRule{c.Protocol, c.FromPort, c.ToPort, c.CidrBlocks, c.Description}, nil
+}
+
+// covers reports whether the rule admits protocol traffic on port.
+func (r sgRule) covers(protocol string, port int) bool {
+	if r.protocol == "-1" {
+		return true
+	}
+	return r.protocol == protocol && r.fromPort <= port && port <= r.toPort
+}
+
+// ingressArgs converts rules to security group ingress arguments.
+func ingressArgs(rules []sgRule) ec2.SecurityGroupIngressArray {
+	var args ec2.SecurityGroupIngressArray
+	for _, r := range rules {
+		args = append(args, &ec2.SecurityGroupIngressArgs{
+			Protocol:    pulumi.String(r.protocol),
+			FromPort:    pulumi.Int(r.fromPort),
+			ToPort:      pulumi.Int(r.toPort),
+			CidrBlocks:  pulumi.ToStringArray(r.cidrBlocks),
+			Description: pulumi.String(r.description),
+		})
+	}
+	return args
+}
+
+// egressArgs converts rules to security group egress arguments.
+func egressArgs(rules []sgRule) ec2.SecurityGroupEgressArray {
+	var args ec2.SecurityGroupEgressArray
+	for _, r := range rules {
+		args = append(args, &ec2.SecurityGroupEgressArgs{
+			Protocol:    pulumi.String(r.protocol),
+			FromPort:    pulumi.Int(r.fromPort),
+			ToPort:      pulumi.Int(r.toPort),
+			CidrBlocks:  pulumi.ToStringArray(r.cidrBlocks),
+			Description: pulumi.String(r.description),
+		})
+	}
+	return args
+}
+
+// rulesOutput renders rules as structured output values for auditing.
+func rulesOutput(rules []sgRule) pulumi.Array {
+	out := pulumi.Array{}
+	for _, r := range rules {
+		out = append(out, pulumi.Map{
+			"protocol":    pulumi.String(r.protocol),
+			"fromPort":    pulumi.Int(r.fromPort),
+			"toPort":      pulumi.Int(r.toPort),
+			"cidrBlocks":  pulumi.ToStringArray(r.cidrBlocks),
+			"description": pulumi.String(r.description),
+		})
+	}
+	return out
+}
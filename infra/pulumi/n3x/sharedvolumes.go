@@ -0,0 +1,55 @@
+package n3x
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// SharedVolumeConfig is one n3x:sharedVolumes entry: an EBS volume created
+// once and attached to every runner (e.g. a read-only tools volume).
+type SharedVolumeConfig struct {
+	Name       string `json:"name"`       // Short name, used in resource names and outputs
+	SizeGb     int    `json:"sizeGb"`     // Required unless snapshotId is set
+	DeviceName string `json:"deviceName"` // Attachment device, normalized to /dev/sd[f-p]
+	VolumeType string `json:"volumeType"` // Default io2 (Multi-Attach capable)
+	Iops       int    `json:"iops"`       // Default 3000 for io1/io2
+	SnapshotId string `json:"snapshotId"` // Optional source snapshot
+}
+
+var sharedVolumeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// settings returns the volume's performance settings with defaults applied.
+func (c SharedVolumeConfig) settings() VolumeSettings {
+	v := VolumeSettings{VolumeType: c.VolumeType, Iops: c.Iops}
+	if v.VolumeType == "" {
+		v.VolumeType = "io2"
+	}
+	if v.Iops == 0 && (v.VolumeType == "io1" || v.VolumeType == "io2") {
+		v.Iops = 3000
+	}
+	return v
+}
+
+// validate checks the entry on its own and normalizes its device name.
+// Whether it can attach to every runner (Multi-Attach) depends on the runner
+// count and is checked once the runners are known.
+func (c *SharedVolumeConfig) validate() error {
+	if !sharedVolumeNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("name %q: use lowercase letters, digits and hyphens", c.Name)
+	}
+	if c.SizeGb <= 0 && c.SnapshotId == "" {
+		return fmt.Errorf("%q: sizeGb or snapshotId is required", c.Name)
+	}
+	dev, err := normalizeDeviceName(c.DeviceName)
+	if err != nil {
+		return fmt.Errorf("%q: %w", c.Name, err)
+	}
+	c.DeviceName = dev
+	if err := c.settings().validate(); err != nil {
+		return fmt.Errorf("%q: %w", c.Name, err)
+	}
+	return nil
+}
+
+// multiAttachTypes are the volume types that support EBS Multi-Attach.
+var multiAttachTypes = map[string]bool{"io1": true, "io2": true}
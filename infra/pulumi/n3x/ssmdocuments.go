@@ -0,0 +1,81 @@
+package n3x
+
+import "encoding/json"
+
+// zfsRepairDocument returns the content of an SSM Command document that
+// re-imports the runners' ZFS pool and remounts /nix, for pools left
+// unimported after a reboot or device change. The pool name is a document
+// parameter defaulting to the disko-zfs/first-boot-format default ("cache").
+func zfsRepairDocument() (string, error) {
+	doc := map[string]any{
+		"schemaVersion": "2.2",
+		"description":   "Import the n3x ZFS cache pool and mount /nix",
+		"parameters": map[string]any{
+			"poolName": map[string]any{
+				"type":           "String",
+				"description":    "ZFS pool name (n3x.disko-zfs.poolName)",
+				"default":        "cache",
+				"allowedPattern": "^[A-Za-z][A-Za-z0-9_.-]*$",
+			},
+		},
+		"mainSteps": []any{
+			map[string]any{
+				"action": "aws:runShellScript",
+				"name":   "importZfsPool",
+				"inputs": map[string]any{
+					"runCommand": []string{
+						"set -eu",
+						"if ! zpool list {{ poolName }} >/dev/null 2>&1; then zpool import -f {{ poolName }}; fi",
+						"zpool clear {{ poolName }}",
+						"mkdir -p /nix",
+						"if ! mountpoint -q /nix; then mount -t zfs {{ poolName }}/nix /nix; fi",
+						"zpool status {{ poolName }}",
+					},
+				},
+			},
+		},
+	}
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// sshKeysDocument returns the content of an SSM Command document that
+// replaces root's authorized_keys with a single public key, so the key can
+// be rotated on running instances. The key is a document parameter; its
+// pattern keeps it on one line and free of quotes.
+func sshKeysDocument() (string, error) {
+	doc := map[string]any{
+		"schemaVersion": "2.2",
+		"description":   "Install the n3x SSH public key as root's authorized_keys",
+		"parameters": map[string]any{
+			"publicKey": map[string]any{
+				"type":           "String",
+				"description":    "authorized_keys line (n3x:sshPublicKey)",
+				"allowedPattern": "^[^'\\r\\n]+$",
+			},
+		},
+		"mainSteps": []any{
+			map[string]any{
+				"action": "aws:runShellScript",
+				"name":   "installSshKey",
+				"inputs": map[string]any{
+					"runCommand": []string{
+						"set -eu",
+						"install -d -m 700 /root/.ssh",
+						"printf '%s\\n' '{{ publicKey }}' > /root/.ssh/authorized_keys.n3x",
+						"chmod 600 /root/.ssh/authorized_keys.n3x",
+						"mv /root/.ssh/authorized_keys.n3x /root/.ssh/authorized_keys",
+					},
+				},
+			},
+		},
+	}
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,59 @@
+package n3x
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// lookupSubnetGroup resolves a "Key=Value" subnet tag to one subnet per AZ
+// (the lowest subnet ID in each), ordered by AZ. All matching subnets must
+// be in one VPC, since the runners share its security groups.
+func lookupSubnetGroup(ctx *pulumi.Context, tag string) ([]*ec2.LookupSubnetResult, error) {
+	key, value, ok := strings.Cut(tag, "=")
+	if !ok || key == "" {
+		return nil, fmt.Errorf("subnet tag %q: expected Key=Value", tag)
+	}
+	found, err := ec2.GetSubnets(ctx, &ec2.GetSubnetsArgs{
+		Tags: map[string]string{key: value},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subnets tagged %s: %w", tag, err)
+	}
+	if len(found.Ids) == 0 {
+		return nil, fmt.Errorf("no subnets tagged %s", tag)
+	}
+
+	ids := append([]string(nil), found.Ids...)
+	sort.Strings(ids)
+	byAz := map[string]*ec2.LookupSubnetResult{}
+	var vpcId string
+	for _, id := range ids {
+		subnet, err := ec2.LookupSubnet(ctx, &ec2.LookupSubnetArgs{Id: pulumi.StringRef(id)})
+		if err != nil {
+			return nil, fmt.Errorf("subnet %s: %w", id, err)
+		}
+		if vpcId == "" {
+			vpcId = subnet.VpcId
+		} else if subnet.VpcId != vpcId {
+			return nil, fmt.Errorf("subnets tagged %s span VPCs %s and %s", tag, vpcId, subnet.VpcId)
+		}
+		if _, ok := byAz[subnet.AvailabilityZone]; !ok {
+			byAz[subnet.AvailabilityZone] = subnet
+		}
+	}
+
+	azs := make([]string, 0, len(byAz))
+	for az := range byAz {
+		azs = append(azs, az)
+	}
+	sort.Strings(azs)
+	subnets := make([]*ec2.LookupSubnetResult, 0, len(azs))
+	for _, az := range azs {
+		subnets = append(subnets, byAz[az])
+	}
+	return subnets, nil
+}
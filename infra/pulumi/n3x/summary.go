@@ -0,0 +1,28 @@
+package n3x
+
+import "fmt"
+
+// stackSummary tallies resources as the program creates them. It backs the
+// summary output, a quick sanity check for reviewers of a preview.
+type stackSummary struct {
+	instances   int
+	volumes     int // Includes instance root volumes
+	attachments int
+	sgRules     int // Ingress + egress
+	ebsGb       int // Total provisioned EBS capacity
+	iops        int // Total effective EBS IOPS
+	throughput  int // Total effective EBS throughput (MiB/s)
+}
+
+// addVolume records an EBS volume of sizeGb with its effective performance.
+func (s *stackSummary) addVolume(sizeGb, iops, throughput int) {
+	s.volumes++
+	s.ebsGb += sizeGb
+	s.iops += iops
+	s.throughput += throughput
+}
+
+func (s stackSummary) String() string {
+	return fmt.Sprintf("%d instances, %d volumes (%d GB EBS), %d attachments, %d security group rules",
+		s.instances, s.volumes, s.ebsGb, s.attachments, s.sgRules)
+}
@@ -0,0 +1,72 @@
+package n3x
+
+import (
+	"maps"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// StandardTags is the base tag set shared by every resource: Project, Stack
+// and, when configured, CostCenter and the deploy metadata. Building every
+// tag map from it keeps resource tags from drifting apart.
+type StandardTags map[string]string
+
+// newStandardTags returns the base tags for stack, omitting CostCenter when
+// costCenter is empty.
+func newStandardTags(stack, costCenter string) StandardTags {
+	t := StandardTags{
+		"Project": "n3x",
+		"Stack":   stack,
+	}
+	if costCenter != "" {
+		t["CostCenter"] = costCenter
+	}
+	return t
+}
+
+// addDeployMetadata adds the DeployCommit and DeployPipelineId tags for the
+// values that are set.
+func (t StandardTags) addDeployMetadata(commit, pipelineId string) {
+	if commit != "" {
+		t["DeployCommit"] = commit
+	}
+	if pipelineId != "" {
+		t["DeployPipelineId"] = pipelineId
+	}
+}
+
+// VolumeTagPolicy holds the settings that tag volumes beyond the base set.
+type VolumeTagPolicy struct {
+	SnapshotTagKey   string // n3x:snapshotTagKey ("" for none)
+	SnapshotTagValue string
+	SnapshotPurposes map[string]bool // Volume purposes that get the snapshot tag
+	RetentionPolicy  string          // n3x:retentionPolicy ("" for none)
+	Persistent       map[string]bool // Volume purposes that outlive their instance
+}
+
+// forVolume returns the base tags plus the snapshot-selection and Retention
+// tags that apply to a volume of the given purpose ("root",
+// "zfs-nix-store", "yocto-cache" or "ccache").
+func (t StandardTags) forVolume(purpose string, p VolumeTagPolicy) StandardTags {
+	out := maps.Clone(t)
+	if p.SnapshotTagKey != "" && p.SnapshotPurposes[purpose] {
+		out[p.SnapshotTagKey] = p.SnapshotTagValue
+	}
+	if p.RetentionPolicy != "" && p.Persistent[purpose] {
+		out["Retention"] = p.RetentionPolicy
+	}
+	return out
+}
+
+// with returns the base tags merged with resource-specific tags such as Name
+// or Purpose; extra wins on conflicting keys.
+func (t StandardTags) with(extra pulumi.StringMap) pulumi.StringMap {
+	out := pulumi.StringMap{}
+	for k, v := range t {
+		out[k] = pulumi.String(v)
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
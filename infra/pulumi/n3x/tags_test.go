@@ -0,0 +1,39 @@
+package n3x
+
+import "testing"
+
+func TestVolumeTagParity(t *testing.T) {
+	base := newStandardTags("prod", "eng-42")
+	policy := VolumeTagPolicy{
+		SnapshotTagKey:   "Backup",
+		SnapshotTagValue: "daily",
+		SnapshotPurposes: map[string]bool{"zfs-nix-store": true},
+		RetentionPolicy:  "keep",
+		Persistent:       map[string]bool{"zfs-nix-store": true, "root": true},
+	}
+	resources := map[string]StandardTags{
+		"instance": base,
+		"root":     base.forVolume("root", policy),
+		"cache":    base.forVolume("zfs-nix-store", policy),
+		"yocto":    base.forVolume("yocto-cache", policy),
+	}
+	want := map[string]string{"Project": "n3x", "Stack": "prod", "CostCenter": "eng-42"}
+	for name, tags := range resources {
+		for k, v := range want {
+			if tags[k] != v {
+				t.Errorf("%s: %s = %q, want %q", name, k, tags[k], v)
+			}
+		}
+	}
+
+	// The policy tags apply by purpose only
+	if resources["cache"]["Backup"] != "daily" || resources["root"]["Backup"] != "" {
+		t.Errorf("snapshot tag: cache %q, root %q", resources["cache"]["Backup"], resources["root"]["Backup"])
+	}
+	if resources["root"]["Retention"] != "keep" || resources["yocto"]["Retention"] != "" {
+		t.Errorf("Retention: root %q, yocto %q", resources["root"]["Retention"], resources["yocto"]["Retention"])
+	}
+	if _, ok := base["Retention"]; ok {
+		t.Error("forVolume modified the base tags")
+	}
+}
@@ -0,0 +1,24 @@
+package n3x
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formatTfvars renders vars as Terraform tfvars (HCL `name = "value"` lines),
+// sorted by name so the output is stable across deploys.
+func formatTfvars(vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s = %s\n", name, strconv.Quote(vars[name]))
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package n3x
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ebs"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// VolumeSettings holds the performance and encryption options of an EBS
+// volume. Zero values mean "AWS default for the type".
+type VolumeSettings struct {
+	VolumeType string // gp3, gp2, io1, io2, st1, sc1, standard
+	Iops       int    // Provisioned IOPS (gp3, io1, io2)
+	Throughput int    // Provisioned throughput in MiB/s (gp3 only)
+	Encrypted  bool
+	KmsKeyId   string // Customer-managed KMS key (implies encrypted)
+}
+
+// volumeTypeLimits gives the valid provisioned-IOPS range per volume type;
+// types absent from the map do not accept an IOPS setting.
+var volumeTypeLimits = map[string]struct{ minIops, maxIops int }{
+	"gp3": {3000, 16000},
+	"io1": {100, 64000},
+	"io2": {100, 256000},
+}
+
+// volumeMinSizeGb gives the smallest volume size per type where it exceeds
+// the 1 GiB general minimum.
+var volumeMinSizeGb = map[string]int{
+	"io1": 4, "io2": 4,
+	"st1": 125, "sc1": 125,
+}
+
+// validVolumeTypes lists the EBS volume types accepted in config.
+var validVolumeTypes = map[string]bool{
+	"gp3": true, "gp2": true, "io1": true, "io2": true,
+	"st1": true, "sc1": true, "standard": true,
+}
+
+// validate checks that the settings form a combination AWS accepts.
+func (v VolumeSettings) validate() error {
+	if !validVolumeTypes[v.VolumeType] {
+		return fmt.Errorf("volume type %q: must be one of gp3, gp2, io1, io2, st1, sc1, standard", v.VolumeType)
+	}
+	if v.Iops != 0 {
+		limits, ok := volumeTypeLimits[v.VolumeType]
+		if !ok {
+			return fmt.Errorf("iops is only valid for gp3, io1 and io2 volumes (type is %s)", v.VolumeType)
+		}
+		if v.Iops < limits.minIops || v.Iops > limits.maxIops {
+			return fmt.Errorf("iops %d out of range for %s (%d-%d)", v.Iops, v.VolumeType, limits.minIops, limits.maxIops)
+		}
+	} else if v.VolumeType == "io1" || v.VolumeType == "io2" {
+		return fmt.Errorf("%s volumes require provisioned iops", v.VolumeType)
+	}
+	if v.Throughput != 0 {
+		if v.VolumeType != "gp3" {
+			return fmt.Errorf("throughput is only valid for gp3 volumes (type is %s)", v.VolumeType)
+		}
+		if v.Throughput < 125 || v.Throughput > 1000 {
+			return fmt.Errorf("throughput %d MiB/s out of range for gp3 (125-1000)", v.Throughput)
+		}
+		// gp3 allows at most 0.25 MiB/s per provisioned IOPS (3000 if unset)
+		iops := v.Iops
+		if iops == 0 {
+			iops = 3000
+		}
+		if v.Throughput*4 > iops {
+			return fmt.Errorf("throughput %d MiB/s exceeds gp3's 0.25 MiB/s per IOPS at %d IOPS; provision at least %d IOPS",
+				v.Throughput, iops, v.Throughput*4)
+		}
+	}
+	return nil
+}
+
+// encrypt sets the encryption of a standalone volume. Unencrypted settings
+// leave it unset, so the account's EBS encryption default applies.
+func (v VolumeSettings) encrypt(args *ebs.VolumeArgs) {
+	if v.Encrypted {
+		args.Encrypted = pulumi.Bool(true)
+	}
+	if v.KmsKeyId != "" {
+		args.KmsKeyId = pulumi.String(v.KmsKeyId)
+	}
+}
+
+// validateSize checks that a volume of sizeGb meets the type's minimum size.
+func (v VolumeSettings) validateSize(sizeGb int) error {
+	if minSize := volumeMinSizeGb[v.VolumeType]; sizeGb < minSize {
+		return fmt.Errorf("%s volumes must be at least %d GiB (size is %d)", v.VolumeType, minSize, sizeGb)
+	}
+	return nil
+}
+
+// effectivePerformance returns the IOPS and throughput (MiB/s) a volume of
+// sizeGb delivers with these settings, filling in AWS defaults for unset
+// values. HDD and magnetic figures are the per-volume baselines.
+func (v VolumeSettings) effectivePerformance(sizeGb int) (iops, throughput int) {
+	switch v.VolumeType {
+	case "gp3":
+		iops, throughput = 3000, 125
+		if v.Iops != 0 {
+			iops = v.Iops
+		}
+		if v.Throughput != 0 {
+			throughput = v.Throughput
+		}
+	case "gp2":
+		// 3 IOPS/GiB (100-16000); 128 MiB/s up to 170 GiB, 250 MiB/s above
+		iops = min(max(3*sizeGb, 100), 16000)
+		throughput = 128
+		if sizeGb > 170 {
+			throughput = 250
+		}
+	case "io1", "io2":
+		// 256 KiB per provisioned IOPS, capped at 1000 MiB/s
+		iops = v.Iops
+		throughput = min(v.Iops/4, 1000)
+	case "st1":
+		iops = 500
+		throughput = min(max(40*sizeGb/1024, 20), 500)
+	case "sc1":
+		iops = 250
+		throughput = min(max(12*sizeGb/1024, 6), 250)
+	case "standard":
+		iops, throughput = 100, 90
+	}
+	return iops, throughput
+}
+
+// plannedVolume is an EBS volume a runner will get, as used by the
+// preview-time quota and bandwidth checks.
+type plannedVolume struct {
+	purpose  string // Purpose tag value ("root" for root volumes)
+	sizeGb   int
+	settings VolumeSettings
+}
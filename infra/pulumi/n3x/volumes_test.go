@@ -0,0 +1,34 @@
+package n3x
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVolumeSettingsThroughputRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings VolumeSettings
+		err      string // Substring of the error, or "" for valid
+	}{
+		{"gp3 at exactly 4 IOPS per MiB/s", VolumeSettings{VolumeType: "gp3", Iops: 4000, Throughput: 1000}, ""},
+		{"gp3 one IOPS short", VolumeSettings{VolumeType: "gp3", Iops: 3999, Throughput: 1000}, "provision at least 4000 IOPS"},
+		{"gp3 default IOPS", VolumeSettings{VolumeType: "gp3", Throughput: 751}, "provision at least 3004 IOPS"},
+		{"io1 has no ratio", VolumeSettings{VolumeType: "io1", Iops: 100}, ""},
+		{"gp2 rejects throughput itself", VolumeSettings{VolumeType: "gp2", Throughput: 1000}, "only valid for gp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}